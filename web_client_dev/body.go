@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var (
+	errMalformedChunk  = errors.New("malformed chunked encoding")
+	errMalformedHeader = errors.New("malformed header field")
+)
+
+// Transfer-Encoding: chunkedのbodyを順に読み出す。
+// 最後のチャンクの後にあるtrailerはtrailerフィールドに入る。
+type chunkedReader struct {
+	r       *bufio.Reader
+	n       uint64 // 読んでいるチャンクの残りバイト数
+	trailer Header
+	err     error
+}
+
+func newChunkedReader(r *bufio.Reader) *chunkedReader {
+	return &chunkedReader{r: r}
+}
+
+func (cr *chunkedReader) Read(p []byte) (int, error) {
+	if cr.err != nil {
+		return 0, cr.err
+	}
+
+	if cr.n == 0 {
+		cr.n, cr.err = cr.readChunkSize()
+		if cr.err != nil {
+			return 0, cr.err
+		}
+
+		// last-chunkの後はtrailerと空行が続く。
+		if cr.n == 0 {
+			cr.trailer, cr.err = readHeaderFields(cr.r)
+			if cr.err == nil {
+				cr.err = io.EOF
+			}
+			return 0, cr.err
+		}
+	}
+
+	if uint64(len(p)) > cr.n {
+		p = p[:cr.n]
+	}
+
+	n, err := cr.r.Read(p)
+	cr.n -= uint64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		cr.err = err
+		return n, err
+	}
+
+	// チャンクのデータの後にはCRLFが来る。
+	if cr.n == 0 {
+		line, err := readLine(cr.r)
+		if err != nil {
+			cr.err = err
+		} else if line != "" {
+			cr.err = errMalformedChunk
+		}
+	}
+
+	return n, nil
+}
+
+// chunk-size [ chunk-ext ] CRLF を読んでchunk-sizeを返す。chunk-extは無視する。
+func (cr *chunkedReader) readChunkSize() (uint64, error) {
+	line, err := readLine(cr.r)
+	if err != nil {
+		return 0, err
+	}
+
+	size, _, _ := strings.Cut(line, ";")
+	size = strings.TrimRight(size, " \t")
+
+	n, err := strconv.ParseUint(size, 16, 63)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid chunk size %q", errMalformedChunk, size)
+	}
+
+	return n, nil
+}
+
+// Content-Lengthの長さだけ読む。途中で接続が切れたらio.ErrUnexpectedEOFを返す。
+type contentLengthReader struct {
+	r io.Reader
+	n int64
+}
+
+func (lr *contentLengthReader) Read(p []byte) (int, error) {
+	if lr.n <= 0 {
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > lr.n {
+		p = p[:lr.n]
+	}
+
+	n, err := lr.r.Read(p)
+	lr.n -= int64(n)
+	if err == io.EOF && lr.n > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == io.EOF {
+		err = nil
+	}
+
+	return n, err
+}
+
+// ステータスコードとヘッダーからbodyの読み方を選ぶ(RFC 9112 6.3)。
+//   - 1xx, 204, 304はbodyがない
+//   - Transfer-Encodingの最後がchunkedならchunkedで読む
+//   - Content-Lengthがあればその長さだけ読む
+//   - それ以外は接続が閉じられるまで読む
+func newBodyReader(r *bufio.Reader, statusCode int, header Header) (io.Reader, error) {
+	transferEncoding := header.Values("Transfer-Encoding")
+	contentLength := header.Values("Content-Length")
+
+	if statusCode/100 == 1 || statusCode == 204 || statusCode == 304 {
+		return &contentLengthReader{r: r, n: 0}, nil
+	}
+
+	if len(transferEncoding) > 0 {
+		codings := strings.Split(strings.Join(transferEncoding, ","), ",")
+		if strings.EqualFold(strings.TrimSpace(codings[len(codings)-1]), "chunked") {
+			return newChunkedReader(r), nil
+		}
+		return r, nil
+	}
+
+	if len(contentLength) > 0 {
+		var length int64 = -1
+		for _, v := range contentLength {
+			n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil || n < 0 || length >= 0 && n != length {
+				return nil, fmt.Errorf("invalid Content-Length %q", strings.Join(contentLength, ", "))
+			}
+			length = n
+		}
+		return &contentLengthReader{r: r, n: length}, nil
+	}
+
+	return r, nil
+}
+
+// CRLF(もしくはLF)までの1行を読み、行末を取り除いて返す。
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+	return line, nil
+}
+
+// 空行までのヘッダーフィールドを読む。
+func readHeaderFields(r *bufio.Reader) (Header, error) {
+	fields := Header{}
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return fields, err
+		}
+
+		if line == "" {
+			return fields, nil
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return fields, fmt.Errorf("%w %q", errMalformedHeader, line)
+		}
+
+		fields.Add(name, strings.Trim(value, " \t"))
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestReadResponseBody(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		msg      string
+		status   int
+		body     string
+		header   Header // 最終的なレスポンスにあるはずのヘッダー
+		trailer  Header
+		reusable bool
+	}{
+		{
+			name:     "content-length",
+			msg:      "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello",
+			status:   200,
+			body:     "hello",
+			reusable: true,
+		},
+		{
+			name:     "repeated equal content-length",
+			msg:      "HTTP/1.1 200 OK\r\nContent-Length: 2\r\nContent-Length: 2\r\n\r\nok",
+			status:   200,
+			body:     "ok",
+			reusable: true,
+		},
+		{
+			name:     "chunked",
+			msg:      "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n7\r\n, world\r\n0\r\n\r\n",
+			status:   200,
+			body:     "hello, world",
+			reusable: true,
+		},
+		{
+			name:     "chunk extensions",
+			msg:      "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5;name=value\r\nhello\r\n3 ; a=\"b;c\"\r\nabc\r\n0;last\r\n\r\n",
+			status:   200,
+			body:     "helloabc",
+			reusable: true,
+		},
+		{
+			name:     "chunked with trailer",
+			msg:      "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nTrailer: X-Checksum\r\n\r\nA\r\n0123456789\r\n0\r\nX-Checksum: abc\r\nX-Other:  1 \r\n\r\n",
+			status:   200,
+			body:     "0123456789",
+			trailer:  Header{"X-Checksum": {"abc"}, "X-Other": {"1"}},
+			reusable: true,
+		},
+		{
+			name:     "chunked is the last transfer coding",
+			msg:      "HTTP/1.1 200 OK\r\nTransfer-Encoding: gzip\r\nTransfer-Encoding: Chunked\r\n\r\n3\r\nabc\r\n0\r\n\r\n",
+			status:   200,
+			body:     "abc",
+			reusable: true,
+		},
+		{
+			name:   "close-delimited",
+			msg:    "HTTP/1.1 200 OK\r\n\r\nuntil the end",
+			status: 200,
+			body:   "until the end",
+		},
+		{
+			name:   "HTTP/1.0",
+			msg:    "HTTP/1.0 200 OK\r\nContent-Length: 2\r\n\r\nok",
+			status: 200,
+			body:   "ok",
+		},
+		{
+			name:   "connection close",
+			msg:    "HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok",
+			status: 200,
+			body:   "ok",
+		},
+		{
+			name:     "204 has no body",
+			msg:      "HTTP/1.1 204 No Content\r\n\r\n",
+			status:   204,
+			reusable: true,
+		},
+		{
+			name:     "304 has no body",
+			msg:      "HTTP/1.1 304 Not Modified\r\nContent-Length: 10\r\n\r\n",
+			status:   304,
+			reusable: true,
+		},
+		{
+			name:     "HEAD has no body",
+			method:   "HEAD",
+			msg:      "HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\n",
+			status:   200,
+			reusable: true,
+		},
+		{
+			name:     "LF line endings",
+			msg:      "HTTP/1.1 200 OK\nContent-Length: 2\n\nok",
+			status:   200,
+			body:     "ok",
+			reusable: true,
+		},
+		{
+			name:     "100 continue before the final response",
+			msg:      "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok",
+			status:   200,
+			body:     "ok",
+			reusable: true,
+		},
+		{
+			name:     "several interim responses",
+			msg:      "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 103 Early Hints\r\nLink: </style.css>; rel=preload\r\n\r\nHTTP/1.1 201 Created\r\nLocation: /a\r\nContent-Length: 0\r\n\r\n",
+			status:   201,
+			header:   Header{"Location": {"/a"}, "Content-Length": {"0"}},
+			reusable: true,
+		},
+		{
+			name:   "101 is final",
+			msg:    "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n",
+			status: 101,
+			header: Header{"Upgrade": {"websocket"}, "Connection": {"Upgrade"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &Request{Method: "GET", Header: Header{}}
+			if tt.method != "" {
+				req.Method = tt.method
+			}
+			resp, err := newResponse(req, []byte(tt.msg))
+			if err != nil {
+				t.Fatalf("newResponse: %v", err)
+			}
+			if resp.StatusCode() != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode(), tt.status)
+			}
+			if resp.Body() != tt.body {
+				t.Errorf("body = %q, want %q", resp.Body(), tt.body)
+			}
+			if tt.header != nil && !maps.EqualFunc(resp.Header(), tt.header, slices.Equal) {
+				t.Errorf("header = %v, want %v", resp.Header(), tt.header)
+			}
+			if !maps.EqualFunc(resp.Trailer(), tt.trailer, slices.Equal) {
+				t.Errorf("trailer = %v, want %v", resp.Trailer(), tt.trailer)
+			}
+			if resp.reusable() != tt.reusable {
+				t.Errorf("reusable = %v, want %v", resp.reusable(), tt.reusable)
+			}
+		})
+	}
+}
+
+func TestReadResponseError(t *testing.T) {
+	tests := []struct {
+		name  string
+		msg   string
+		kind  error
+		stage Stage
+	}{
+		{"empty", "", ErrProtocol, StageReadHeader},
+		{"not HTTP", "SSH-2.0-OpenSSH\r\n\r\n", ErrMalformedResponse, StageReadHeader},
+		{"short status code", "HTTP/1.1 20 OK\r\n\r\n", ErrMalformedResponse, StageReadHeader},
+		{"status code below 100", "HTTP/1.1 099 Odd\r\n\r\n", ErrMalformedResponse, StageReadHeader},
+		{"header without colon", "HTTP/1.1 200 OK\r\nBroken\r\n\r\n", ErrMalformedResponse, StageReadHeader},
+		{"space before colon", "HTTP/1.1 200 OK\r\nName : value\r\n\r\n", ErrMalformedResponse, StageReadHeader},
+		{"header cut off", "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n", ErrProtocol, StageReadHeader},
+		{"interim response only", "HTTP/1.1 100 Continue\r\n\r\n", ErrProtocol, StageReadHeader},
+		{"invalid content-length", "HTTP/1.1 200 OK\r\nContent-Length: -1\r\n\r\n", ErrProtocol, StageReadHeader},
+		{"conflicting content-length", "HTTP/1.1 200 OK\r\nContent-Length: 2\r\nContent-Length: 3\r\n\r\nabc", ErrProtocol, StageReadHeader},
+		{"body shorter than content-length", "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nabc", ErrProtocol, StageReadBody},
+		{"invalid chunk size", "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\nabc\r\n0\r\n\r\n", ErrProtocol, StageReadBody},
+		{"chunk longer than its size", "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n2\r\nabc\r\n0\r\n\r\n", ErrProtocol, StageReadBody},
+		{"chunked without last chunk", "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n", ErrProtocol, StageReadBody},
+		{"malformed trailer", "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n0\r\nno colon\r\n\r\n", ErrMalformedResponse, StageReadBody},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newResponse(nil, []byte(tt.msg))
+			if !errors.Is(err, tt.kind) {
+				t.Fatalf("err = %v, want %v", err, tt.kind)
+			}
+			var re *RequestError
+			if !errors.As(err, &re) || re.Stage != tt.stage {
+				t.Errorf("stage of %v, want %s", err, tt.stage)
+			}
+		})
+	}
+}
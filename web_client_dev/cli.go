@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+)
+
+// コマンドラインモードの終了コード。レスポンスを受け取れたときはステータスコードで決める。
+const (
+	exitOK          = 0   // 1xx, 2xx, 3xx
+	exitError       = 1   // リクエストを送れなかった、レスポンスを読めなかった
+	exitUsage       = 2   // 引数が正しくない
+	exitTimeout     = 3   // 時間内に接続できなかった、レスポンスが届かなかった
+	exitClientError = 4   // 4xx
+	exitServerError = 5   // 5xx
+	exitInterrupted = 130 // Ctrl-Cで中断した
+)
+
+var outputFormats = []string{"body", "headers", "full", "status", "json"}
+
+const cliUsage = `usage: client [flags] URL
+
+Sends one HTTP request to URL (e.g. http://localhost:8080/path?q=1), prints the
+response and exits. Without arguments the interactive screen starts instead.
+
+exit status: 0 for 1xx-3xx, 4 for 4xx, 5 for 5xx, 1 if no response was received,
+2 for invalid arguments, 3 if the request timed out, 130 if interrupted.
+
+The port may be a number (1-65535) or a service name (http, https). Ports can be
+restricted with web_client/ports.json in the user config directory, e.g.
+{"allow": ["80", "8000-8999"], "deny": ["8081"]}.
+
+flags:
+`
+
+// 何度でも指定できる"-H name: value"。
+type headerFlags []string
+
+func (h *headerFlags) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerFlags) Set(v string) error {
+	name, _, ok := strings.Cut(v, ":")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("header must be \"name: value\": %q", v)
+	}
+	*h = append(*h, v)
+	return nil
+}
+
+// コマンドラインの引数からリクエストを作って送り、レスポンスをstdoutに出す。終了コードを返す。
+func runCLI(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("client", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, cliUsage)
+		fs.PrintDefaults()
+	}
+
+	var headers headerFlags
+	method := fs.String("X", "", "request method (default GET, or POST with -d)")
+	fs.Var(&headers, "H", "request header \"name: value\" (repeatable)")
+	data := fs.String("d", "", "request body; @file reads a file, @- reads stdin")
+	output := fs.String("o", "body", "output format: "+strings.Join(outputFormats, ", "))
+	saveTo := fs.String("O", "", "save the body to `file` instead of printing it")
+	timeouts := DefaultTimeouts
+	fs.DurationVar(&timeouts.Total, "timeout", timeouts.Total, "limit for the whole request including the body (0: none; reads still fail after -read-timeout without data)")
+	fs.DurationVar(&timeouts.DNS, "dns-timeout", timeouts.DNS, "limit for resolving the host name")
+	fs.DurationVar(&timeouts.Connect, "connect-timeout", timeouts.Connect, "limit for connecting")
+	fs.DurationVar(&timeouts.TLSHandshake, "tls-timeout", timeouts.TLSHandshake, "limit for the TLS handshake")
+	fs.DurationVar(&timeouts.Write, "write-timeout", timeouts.Write, "limit for sending the request")
+	fs.DurationVar(&timeouts.FirstByte, "ttfb-timeout", timeouts.FirstByte, "limit for the first byte of the response after sending")
+	fs.DurationVar(&timeouts.Read, "read-timeout", timeouts.Read, "limit for waiting for more of the response after the first byte (0: none)")
+	noHistory := fs.Bool("no-history", false, "do not record the request in the history")
+	timing := fs.Bool("timing", false, "print the time spent in each phase of the request to stderr")
+
+	// URLの後ろにフラグを書いてもよいように、フラグでない引数を取り出しながら読む。
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return exitOK
+			}
+			return exitUsage
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(positional) != 1 {
+		fmt.Fprintln(stderr, "client: exactly one URL is required")
+		fs.Usage()
+		return exitUsage
+	}
+	if !slices.Contains(outputFormats, *output) {
+		fmt.Fprintf(stderr, "client: unknown output format %q (supported: %s)\n", *output, strings.Join(outputFormats, ", "))
+		return exitUsage
+	}
+
+	body, err := readBodyArg(*data, stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "client: %v\n", err)
+		return exitUsage
+	}
+	if *method == "" {
+		*method = "GET"
+		if *data != "" {
+			*method = "POST"
+		}
+	}
+
+	client, req, err := newCLIRequest(*method, positional[0], headers, body)
+	if err != nil {
+		fmt.Fprintf(stderr, "client: %v\n", err)
+		return exitUsage
+	}
+	if path, err := defaultPortPolicyPath(); err == nil {
+		policy, err := LoadPortPolicy(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "client: %v\n", err)
+			return exitError
+		}
+		client.SetPortPolicy(policy)
+	}
+	if !*noHistory {
+		if path, err := defaultHistoryPath(); err == nil {
+			client.SetHistory(NewHistory(path))
+		}
+	}
+
+	client.SetTimeouts(timeouts)
+
+	// Ctrl-Cで送っている途中のリクエストをやめる。
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	resp, err := client.SendContext(ctx, req)
+	if err != nil {
+		return requestFailed(stderr, err)
+	}
+	err = writeResponse(stdout, resp, *output, *saveTo)
+	resp.Close()
+	// bodyを読んでいて失敗したのか、書き出すのに失敗したのかで終了コードを分ける
+	if resp.err != nil {
+		return requestFailed(stderr, resp.err)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "client: %v\n", err)
+		return exitError
+	}
+	if client.history != nil && client.history.Err() != nil {
+		fmt.Fprintf(stderr, "client: cannot write history: %v\n", client.history.Err())
+	}
+
+	if *timing {
+		for _, l := range resp.Timing().waterfall(60) {
+			fmt.Fprintln(stderr, l)
+		}
+	}
+	return exitCode(resp.StatusCode())
+}
+
+// リクエストが失敗した理由を書き出し、終了コードを返す。
+func requestFailed(stderr io.Writer, err error) int {
+	fmt.Fprintf(stderr, "client: %v\n", err)
+	switch {
+	case errors.Is(err, ErrTimeout):
+		return exitTimeout
+	case errors.Is(err, ErrCanceled):
+		return exitInterrupted
+	}
+	return exitError
+}
+
+// -dの値からbodyを読む。
+func readBodyArg(data string, stdin io.Reader) ([]byte, error) {
+	switch {
+	case data == "@-":
+		return io.ReadAll(stdin)
+	case strings.HasPrefix(data, "@"):
+		return os.ReadFile(data[1:])
+	}
+	return []byte(data), nil
+}
+
+// respのbodyをpathのファイルに書き出す。
+func saveBody(resp *Response, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := resp.WriteBodyTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// URLとフラグの値からHTTPClientとRequestを作る。-HでAuthorizationを指定しなければ、URLのuserinfoでBasic認証にする。
+func newCLIRequest(method, rawURL string, headers headerFlags, body []byte) (*HTTPClient, *Request, error) {
+	u, err := ParseURL(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := NewRequest(method, u.RequestURI(), body)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, h := range headers {
+		name, value, _ := strings.Cut(h, ":")
+		req.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	if auth := u.basicAuth(); auth != "" && req.Header.Get("Authorization") == "" {
+		req.Header.Set("Authorization", auth)
+	}
+
+	if u.Scheme == "https" {
+		return NewHTTPSClient(u.Host, u.Port), req, nil
+	}
+	return NewHTTPClient(u.Host, u.Port), req, nil
+}
+
+// respをformatの形でwに書き出す。bodyはメモリに溜めずに読みながら書き出す。
+// saveToがあればbodyはそのファイルに書き、wには出さない。
+func writeResponse(w io.Writer, resp *Response, format, saveTo string) error {
+	if saveTo != "" {
+		if err := saveBody(resp, saveTo); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	switch format {
+	case "body":
+		_, err = resp.WriteBodyTo(w)
+	case "status":
+		if _, err = resp.WriteBodyTo(io.Discard); err == nil {
+			_, err = fmt.Fprintln(w, resp.StatusCode())
+		}
+	case "headers", "full":
+		var b strings.Builder
+		b.WriteString(resp.Status() + "\n")
+		for _, l := range resp.Header().lines() {
+			b.WriteString(l + "\n")
+		}
+		if format == "full" {
+			b.WriteString("\n")
+		}
+		if _, err = io.WriteString(w, b.String()); err != nil {
+			return err
+		}
+		if format == "full" {
+			_, err = resp.WriteBodyTo(w)
+		} else {
+			_, err = resp.WriteBodyTo(io.Discard)
+		}
+	case "json":
+		// JSONの文字列にするのでbodyを全て読む
+		if err = resp.readBody(); err != nil {
+			return err
+		}
+		err = json.NewEncoder(w).Encode(struct {
+			Status  int                `json:"status"`
+			Proto   string             `json:"proto"`
+			Reason  string             `json:"reason"`
+			Header  Header             `json:"header"`
+			Body    string             `json:"body"`
+			Trailer Header             `json:"trailer,omitempty"`
+			Timing  map[string]float64 `json:"timing_ms"`
+		}{resp.StatusCode(), resp.Proto(), resp.Reason(), resp.Header(), resp.Body(), resp.Trailer(), resp.Timing().millis()})
+	}
+	return err
+}
+
+func exitCode(status int) int {
+	switch {
+	case status >= 500:
+		return exitServerError
+	case status >= 400:
+		return exitClientError
+	}
+	return exitOK
+}
@@ -1,192 +1,541 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
-	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
-const (
-	httpPortNum = 8080
-	crlf        = "\r\n"
-
-	matchHostNameString  = "\\.[a-z]+$"
-	matchIPAddressString = "[0-9]+.[0-9]+.[0-9]+"
-	matchPortString      = "^8080$"
-
-	inEligiblePortNumber = "不適切なポート番号です。"
-	inEligibleTarget     = "不適切な接続先名です。"
-)
+const crlf = "\r\n"
 
 type HTTPClient struct {
 	target     string
 	port       string
 	httpMethod string
 	address    string
-	conn       net.Conn
+	useTLS     bool
+	timeouts   Timeouts
+	pool       *ConnPool   // nilなら1回ごとに接続して閉じる
+	history    *History    // nilでなければ送ったリクエストを記録する
+	policy     *PortPolicy // nilならどのポートにも接続する
 }
 
 func NewHTTPClient(target, port string) *HTTPClient {
 	return &HTTPClient{
-		target:  target,
-		port:    port,
-		address: fmt.Sprintf("%s:%s", target, port),
+		target:   target,
+		port:     port,
+		address:  net.JoinHostPort(target, port),
+		timeouts: DefaultTimeouts,
 	}
 }
 
+// TLSで接続するHTTPClientを作る。
+func NewHTTPSClient(target, port string) *HTTPClient {
+	c := NewHTTPClient(target, port)
+	c.useTLS = true
+	return c
+}
+
+// 段階ごとの制限時間を設定する。
+func (c *HTTPClient) SetTimeouts(t Timeouts) {
+	c.timeouts = t
+}
+
+// 送ったリクエストをhに記録するようにする。
+func (c *HTTPClient) SetHistory(h *History) {
+	c.history = h
+}
+
+// pの接続を使い回すようにする。keep-aliveで接続を保ち、Connection: closeを付けない。
+func (c *HTTPClient) SetPool(p *ConnPool) {
+	c.pool = p
+}
+
+// pの決まりで許されたポートにだけ接続するようにする。
+func (c *HTTPClient) SetPortPolicy(p *PortPolicy) {
+	c.policy = p
+}
+
 type Response struct {
-	rawContent []byte
-	_status    string
-	_header    string
-	_body      string
+	request     *Request
+	_status     string
+	_proto      string
+	_statusCode int
+	_reason     string
+	_header     Header
+	_body       string
+	_trailer    Header
+
+	body    io.Reader    // まだ読んでいないbody
+	raw     *countReader // 受け取ったメッセージのバイト数を数える
+	pc      *persistConn // bodyを読み終えたら閉じるかプールに戻す接続
+	pool    *ConnPool
+	ctx     context.Context
+	stop    func() bool // ctxが終わったら接続をキャンセルするのをやめる
+	cancel  context.CancelFunc
+	timing  *Timing
+	eof     bool  // bodyを最後まで読んだ
+	err     error // bodyを読んでいて起きたエラー
+	onClose func(*Response)
+	closed  bool
 }
 
-func NewResponse(buffer []byte) *Response {
-	r := &Response{rawContent: buffer}
-	r._extractMsg()
-	return r
+// bufferをHTTPレスポンスメッセージとして解析する。
+func NewResponse(buffer []byte) (*Response, error) {
+	return newResponse(nil, buffer)
 }
 
-// status-line, header, bodyの値をフィールドに入れる。
-func (resp *Response) _extractMsg() {
-	resp.Status()
-	resp.Header()
-	resp.Body()
+// reqに対するレスポンスとしてbufferを解析する。HEADへのレスポンスにはbodyがない。
+func newResponse(req *Request, buffer []byte) (*Response, error) {
+	r, err := readResponse(req, bytes.NewReader(buffer))
+	if err != nil {
+		return nil, err
+	}
+	if err := r.readBody(); err != nil {
+		return nil, err
+	}
+	return r, nil
 }
 
-// HTTPステータスラインを取得する。すでに持っていればその値を返す。
-func (resp *Response) Status() string {
-	if resp._status != "" {
-		return resp._status
+// rからstatus-lineとヘッダーを読む。bodyは読まずにBodyReaderから読めるようにしておく。
+// 101以外の1xxは途中経過のレスポンスなので読み飛ばし、続く最終的なレスポンスを返す(RFC 9110 15.2)。
+func readResponse(req *Request, r io.Reader) (*Response, error) {
+	resp := &Response{request: req, raw: &countReader{r: r}}
+	reader := bufio.NewReader(resp.raw)
+
+	for {
+		line, err := readLine(reader)
+		if err != nil {
+			return nil, newRequestError(StageReadHeader, "", nil, fmt.Errorf("can not read status line: %w", err))
+		}
+		if err := resp._parseStatusLine(line); err != nil {
+			return nil, newRequestError(StageReadHeader, "", ErrMalformedResponse, err)
+		}
+
+		resp._header, err = readHeaderFields(reader)
+		if err != nil {
+			return nil, newRequestError(StageReadHeader, "", nil, fmt.Errorf("can not read header: %w", err))
+		}
+		if resp._statusCode/100 != 1 || resp._statusCode == 101 {
+			break
+		}
 	}
 
-	// rawContentからstatusの内容を取得する。
-	i := bytes.Index(resp.rawContent, []byte(crlf))
-	resp._status = string(resp.rawContent[:i])
+	var err error
 
-	return resp._status
+	if req != nil && req.Method == "HEAD" {
+		resp.body = &contentLengthReader{r: reader, n: 0}
+		return resp, nil
+	}
+	resp.body, err = newBodyReader(reader, resp._statusCode, resp._header)
+	if err != nil {
+		return nil, newRequestError(StageReadHeader, "", ErrProtocol, err)
+	}
+	return resp, nil
 }
 
-// HTTPレスポンスヘッダーを取得する。すでに持っていればその値を返す。
-func (resp *Response) Header() string {
-	if resp._header != "" {
-		return resp._header
+// status-line = HTTP-version SP status-code SP [ reason-phrase ]
+func (resp *Response) _parseStatusLine(line string) error {
+	proto, rest, ok := strings.Cut(line, " ")
+	code, reason, _ := strings.Cut(rest, " ")
+
+	if !ok || !strings.HasPrefix(proto, "HTTP/") || len(code) != 3 {
+		return fmt.Errorf("malformed status line %q", line)
+	}
+
+	statusCode, err := strconv.Atoi(code)
+	if err != nil || statusCode < 100 {
+		return fmt.Errorf("malformed status code in status line %q", line)
 	}
 
-	// rawContentからheaderの内容を取得する。
-	i := bytes.Index(resp.rawContent, []byte(crlf)) + len(crlf) // heaaderとstatusの境目
-	j := bytes.Index(resp.rawContent, []byte(crlf+crlf))        // headerとbodyの境目
-	resp._header = string(resp.rawContent[i:j])
+	resp._status = line
+	resp._proto = proto
+	resp._statusCode = statusCode
+	resp._reason = reason
+	return nil
+}
+
+// HTTPステータスライン(e.g. HTTP/1.1 200 OK)を取得する。
+func (resp *Response) Status() string {
+	return resp._status
+}
+
+// HTTPバージョン(e.g. HTTP/1.1)を取得する。
+func (resp *Response) Proto() string {
+	return resp._proto
+}
+
+// ステータスコード(e.g. 200)を取得する。
+func (resp *Response) StatusCode() int {
+	return resp._statusCode
+}
+
+// reason-phrase(e.g. OK)を取得する。
+func (resp *Response) Reason() string {
+	return resp._reason
+}
 
+// このレスポンスを返したリクエストを取得する。
+func (resp *Response) Request() *Request {
+	return resp.request
+}
+
+// HTTPレスポンスヘッダーを取得する。
+func (resp *Response) Header() Header {
 	return resp._header
 }
 
-// HTTPレスポンスボディを取得する。すでに持っていればその値を返す。
+// デコード済みのHTTPレスポンスボディを取得する。Doで受け取ったときだけ入っている。
 func (resp *Response) Body() string {
-	if resp._body != "" {
-		return resp._body
+	return resp._body
+}
+
+// chunkedのbodyの後に送られてきたtrailerを取得する。bodyを読み終えてから入る。
+func (resp *Response) Trailer() Header {
+	return resp._trailer
+}
+
+// デコードしたbodyを先頭から読むReader。message-bodyの終わりでio.EOFを返す。
+func (resp *Response) BodyReader() io.Reader {
+	return bodyStream{resp}
+}
+
+// リクエストの段階ごとの時刻。bodyを読み終えるかCloseしたところでそろう。
+func (resp *Response) Timing() Timing {
+	if resp.timing == nil {
+		return Timing{}
 	}
+	return *resp.timing
+}
 
-	// rawContentからbodyの内容を取得する。
-	i := bytes.Index(resp.rawContent, []byte(crlf+crlf)) // headerとbodyの境目
-	rawBody := resp.rawContent[i:]
+// これまでに受け取ったレスポンスメッセージのバイト数。
+func (resp *Response) Size() int64 {
+	return resp.raw.n
+}
 
-	crlf := []byte("\r\n")
-	rawBody = bytes.Trim(rawBody, string(crlf))
-	j := bytes.Index(rawBody, crlf) + len(crlf) + 1 // chunke-sizeの境目
+// bodyを全て読んでBodyに入れる。
+func (resp *Response) readBody() error {
+	body, err := io.ReadAll(resp.BodyReader())
+	resp._body = string(body)
+	return err
+}
 
-	k := bytes.LastIndex(rawBody, crlf) // 末尾の0との境目
-	resp._body = string(rawBody[j:k])
+// bodyを全て読んでwに書き出し、書いたバイト数を返す。
+func (resp *Response) WriteBodyTo(w io.Writer) (int64, error) {
+	return io.Copy(w, resp.BodyReader())
+}
 
-	// TODO: chuke-sizeも抽出予定
-	return resp._body
+// 接続を閉じる。bodyを読み終えたら、もしくは読むのをやめるときに呼ぶ。
+// プールから取り出した接続は、使い回せればプールに戻す。
+func (resp *Response) Close() error {
+	if resp.closed {
+		return nil
+	}
+	resp.closed = true
+	if resp.timing != nil && resp.timing.BodyDone.IsZero() {
+		resp.timing.BodyDone = time.Now()
+	}
+
+	// キャンセルされた接続は、読み書きの期限を過去にしてあるので使い回せない。
+	canceled := resp.stop != nil && !resp.stop()
+	if resp.cancel != nil {
+		resp.cancel()
+	}
+
+	var err error
+	switch {
+	case resp.pc == nil:
+	case resp.pool == nil:
+		err = resp.pc.Close()
+	case !canceled && resp.reusable():
+		resp.pc.SetDeadline(time.Time{})
+		resp.pool.put(resp.pc)
+	default:
+		resp.pool.discard(resp.pc)
+	}
+	if resp.onClose != nil {
+		resp.onClose(resp)
+	}
+	return err
 }
 
-// HTTPレスポンスメッセージを受け取り、その内容をResponse構造体に含めて返す。
-func (c HTTPClient) getHTTPResponse() (*Response, error) {
+// bodyを最後まで読み、どちらもConnection: closeを送っていなければ接続を使い回せる。
+// 接続が閉じられるまで読むbodyの後や、101で別のプロトコルに切り替わった後は使い回せない。
+func (resp *Response) reusable() bool {
+	switch resp.body.(type) {
+	case *contentLengthReader, *chunkedReader:
+	default:
+		return false
+	}
+	return resp._statusCode != 101 && resp.eof && resp.err == nil && resp._proto == "HTTP/1.1" &&
+		!hasToken(resp._header.Values("Connection"), "close") &&
+		(resp.request == nil || !hasToken(resp.request.Header.Values("Connection"), "close"))
+}
 
-	err := c.sendHTTPRequest()
+// カンマ区切りの値のどれかがtokenであるか。
+func hasToken(values []string, token string) bool {
+	for _, v := range values {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// bodyを読みながら、終わりに来たらtrailerを、途中で失敗したらそのエラーをResponseに残す。
+type bodyStream struct {
+	resp *Response
+}
+
+func (s bodyStream) Read(p []byte) (int, error) {
+	n, err := s.resp.body.Read(p)
+	if err != nil && err != io.EOF {
+		address := ""
+		if s.resp.pc != nil {
+			address = s.resp.pc.address
+		}
+		err = newRequestError(StageReadBody, address, nil, err)
+		if s.resp.ctx != nil {
+			err = contextError(s.resp.ctx, err)
+		}
+	}
+	switch {
+	case err == io.EOF:
+		s.resp.eof = true
+		if t := s.resp.timing; t != nil && t.BodyDone.IsZero() {
+			t.BodyDone = time.Now()
+		}
+		if cr, ok := s.resp.body.(*chunkedReader); ok {
+			s.resp._trailer = cr.trailer
+		}
+	case err != nil && s.resp.err == nil:
+		s.resp.err = err
+	}
+	return n, err
+}
+
+// 読んだバイト数を数える。
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// GET /のHTTPレスポンスメッセージを受け取り、その内容をResponse構造体に含めて返す。
+func (c HTTPClient) getHTTPResponse() (*Response, error) {
+	req, err := NewRequest("GET", "/", nil)
 	if err != nil {
 		return nil, err
 	}
 
-	rawResponse, err := c.readAllHTTPResponse()
+	return c.Do(req)
+}
+
+// reqを送り、受け取ったHTTPレスポンスメッセージをResponse構造体に含めて返す。
+// bodyは全て読んでBodyに入れる。
+func (c HTTPClient) Do(req *Request) (*Response, error) {
+	return c.DoContext(context.Background(), req)
+}
+
+// ctxが終わったらその時点で失敗するDo。
+func (c HTTPClient) DoContext(ctx context.Context, req *Request) (*Response, error) {
+	resp, err := c.SendContext(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	err = resp.readBody()
+	resp.Close()
 	if err != nil {
 		return nil, err
 	}
+	return resp, nil
+}
 
-	resp := NewResponse(rawResponse)
-	return resp, err
+// reqを送り、status-lineとヘッダーを読んだところでResponseを返す。
+// bodyはBodyReaderかWriteBodyToで読み、読み終えたらCloseする。
+// 履歴を設定していれば、失敗したときかCloseしたときに記録する。
+func (c HTTPClient) Send(req *Request) (*Response, error) {
+	return c.SendContext(context.Background(), req)
 }
 
-// TCPでの接続を行う。
-func (c *HTTPClient) _connect() error {
-	conn, err := net.Dial("tcp", c.address)
+// ctxが終わったらその時点で失敗するSend。bodyを読んでいる途中でも読み込みが失敗する。
+func (c HTTPClient) SendContext(ctx context.Context, req *Request) (*Response, error) {
+	start := time.Now()
+	ctx, cancel := withTimeout(ctx, c.timeouts.Total)
+	resp, err := c.send(ctx, req, &Timing{Start: start})
 	if err != nil {
-		return err
+		cancel()
+		if c.history != nil {
+			c.history.record(c, req, nil, err, start)
+		}
+		return nil, err
 	}
 
-	c.conn = conn
-	return nil
+	resp.cancel = cancel
+	if c.history != nil {
+		resp.onClose = func(resp *Response) {
+			c.history.record(c, req, resp, resp.err, start)
+		}
+	}
+	return resp, nil
 }
 
-// TCPでメッセージを送る。
-func (c *HTTPClient) _write(msg []byte) error {
-	_, err := c.conn.Write(msg)
+// プールの接続を使い回してリクエストを送る。相手に閉じられていた接続で失敗したときは、
+// 送り直しても問題のないメソッドなら新しい接続でもう一度だけ送る。
+func (c HTTPClient) send(ctx context.Context, req *Request, t *Timing) (*Response, error) {
+	if err := c.policy.Check(c.port); err != nil {
+		return nil, err
+	}
+
+	msg, err := req.encode(c.hostHeader(), c.pool != nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	for retried := false; ; retried = true {
+		pc, err := c.getConn(ctx, t)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := c.roundTrip(ctx, pc, req, msg, t)
+		if err == nil {
+			return resp, nil
+		}
+		if retried || !pc.reused || !isIdempotent(req.Method) || !isStaleConnError(err) || ctx.Err() != nil {
+			return nil, err
+		}
+	}
 }
 
-// HTTP version 1.1
-// HTTPリクエストを投げる。
-func (c *HTTPClient) sendHTTPRequest() error {
-	var (
-		// とりあえずhttpメソッドは固定。今後変更予定。
-		requestLine        = "GET / HTTP/1.1"
-		requestHeader      = fmt.Sprintf("Host: %s \r\nConnection: close", c.target)
-		httpRequestMessage = []byte(fmt.Sprint(requestLine, crlf, requestHeader, crlf, crlf))
-	)
-
-	if err := c._connect(); err != nil {
-		fmt.Printf("can not connect to target(%s) error: %s \n", c.target, err)
-		// TODO: どの箇所でエラーが生じたのかがわかるようにする。
-		os.Exit(1)
-	}
-
-	err := c._write(httpRequestMessage)
+// pcでmsgを送り、レスポンスのstatus-lineとヘッダーを読む。失敗したらpcを閉じる。
+// ctxが終わったら、読み書きしている途中でもpcをキャンセルする。
+func (c HTTPClient) roundTrip(ctx context.Context, pc *persistConn, req *Request, msg []byte, t *Timing) (*Response, error) {
+	stop := context.AfterFunc(ctx, pc.cancel)
+
+	t.WriteStart = time.Now()
+	pc.setWriteDeadline(deadlineAfter(c.timeouts.Write))
+	err := c.sendHTTPRequest(pc, msg)
+	pc.setWriteDeadline(time.Time{})
+	t.WroteRequest = time.Now()
+
+	var resp *Response
+	if err == nil {
+		pc.setReadDeadline(deadlineAfter(c.timeouts.FirstByte))
+		resp, err = readResponse(req, &idleReader{pc: pc, idle: c.timeouts.Read, first: func() {
+			t.FirstByte = time.Now()
+		}})
+	}
 	if err != nil {
-		return err
+		stop()
+		if c.pool != nil {
+			c.pool.discard(pc)
+		} else {
+			pc.Close()
+		}
+		var re *RequestError
+		if errors.As(err, &re) && re.Address == "" {
+			re.Address = c.address
+		}
+		return nil, contextError(ctx, err)
 	}
 
-	return nil
+	resp.pc = pc
+	resp.pool = c.pool
+	resp.ctx = ctx
+	resp.stop = stop
+	resp.timing = t
+	return resp, nil
 }
 
-// 受け取ったHTTPレスポンスメッセージの内容を全て読みとる。
-func (c HTTPClient) readAllHTTPResponse() ([]byte, error) {
-	c.conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+// 最初のバイトを読んだときにfirstを呼ぶ。それからは読むたびに、idleだけ先に期限を延ばす。
+// 途中で止まった相手を、全体の制限時間がなくても待ち続けないようにする。
+type idleReader struct {
+	pc    *persistConn
+	idle  time.Duration
+	first func()
+}
 
-	slice := make([]byte, 1024)
-	var buffer []byte
-	var n int = 1
+func (r *idleReader) Read(p []byte) (int, error) {
+	if r.first == nil {
+		r.pc.setReadDeadline(deadlineAfter(r.idle))
+	}
+	n, err := r.pc.Read(p)
+	if n > 0 && r.first != nil {
+		r.first()
+		r.first = nil
+	}
+	return n, err
+}
 
-	for n != 0 {
-		n, err := c.conn.Read(slice)
+// Hostヘッダーの値。デフォルトのポートなら省略する。
+func (c HTTPClient) hostHeader() string {
+	if c.port == "" || c.port == c.defaultPort() {
+		if strings.Contains(c.target, ":") {
+			return "[" + c.target + "]"
+		}
+		return c.target
+	}
+	return c.address
+}
+
+// schemeのデフォルトのポート番号。
+func (c HTTPClient) defaultPort() string {
+	if c.useTLS {
+		return defaultPorts["https"]
+	}
+	return defaultPorts["http"]
+}
+
+// 接続を用意する。プールがあれば待たせている接続を使う。
+// 使い回した接続なら、tの名前解決と接続の時刻は空のままになる。
+func (c HTTPClient) getConn(ctx context.Context, t *Timing) (*persistConn, error) {
+	*t = Timing{Start: t.Start}
+	dial := func() (net.Conn, error) {
+		return c.dial(ctx, t)
+	}
+	if c.pool == nil {
+		conn, err := dial()
 		if err != nil {
-			if err == io.EOF {
-				fmt.Println("done!")
-				break
-			}
-			fmt.Println("can not read response error: ", err)
-			return buffer, err
+			return nil, err
 		}
-		buffer = append(buffer, slice[:n]...)
+		return &persistConn{Conn: conn, address: c.poolKey()}, nil
 	}
 
-	return buffer, nil
+	pc, err := c.pool.get(ctx, c.poolKey(), dial)
+	if err != nil {
+		// 空きを待っている間にctxが終わったときのエラーもRequestErrorにする
+		return nil, newRequestError(StageConnect, c.address, nil, err)
+	}
+	t.Reused = pc.reused
+	return pc, nil
+}
+
+// プールで接続を分けるためのキー。httpとhttpsの接続は使い回さない。
+func (c HTTPClient) poolKey() string {
+	if c.useTLS {
+		return "https://" + c.address
+	}
+	return c.address
+}
+
+// HTTP version 1.1
+// HTTPリクエストメッセージを投げる。
+func (c HTTPClient) sendHTTPRequest(conn net.Conn, msg []byte) error {
+	_, err := conn.Write(msg)
+	return newRequestError(StageWrite, c.address, nil, err)
 }
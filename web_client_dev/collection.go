@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// 名前をつけて保存したリクエスト。Nameは"folder/name"の形で、最後の/より前がフォルダになる。
+type SavedRequest struct {
+	Name        string        `json:"name"`
+	RequestLine string        `json:"requestLine"`
+	Headers     []HeaderField `json:"headers"`
+	Body        string        `json:"body"`
+}
+
+func (r SavedRequest) Folder() string {
+	i := strings.LastIndex(r.Name, "/")
+	if i < 0 {
+		return ""
+	}
+	return r.Name[:i]
+}
+
+// フォルダを除いた名前。
+func (r SavedRequest) BaseName() string {
+	return r.Name[strings.LastIndex(r.Name, "/")+1:]
+}
+
+// 保存したリクエストの一覧。pathのJSONファイルに書き出す。
+// Requestsはフォルダ、名前の順に並べておく。
+type Collection struct {
+	Requests []SavedRequest `json:"requests"`
+
+	path string
+}
+
+// コレクションのファイルの場所。$XDG_CONFIG_HOMEなどの下に置く。
+func defaultCollectionPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "web_client", "collection.json"), nil
+}
+
+// pathからコレクションを読む。ファイルがなければ空のコレクションを返す。
+func LoadCollection(path string) (*Collection, error) {
+	c := &Collection{path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+
+	if err := json.Unmarshal(data, c); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	c.sort()
+	return c, nil
+}
+
+// ファイルに書き出す。途中で失敗しても元のファイルが壊れないように、一時ファイルを置き換える。
+func (c *Collection) Save() error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// 保存したリクエストには認証のヘッダーが入ることがあるので、自分だけが読めるようにする。
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(c.path), ".collection-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), c.path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+func (c *Collection) sort() {
+	slices.SortFunc(c.Requests, func(a, b SavedRequest) int {
+		if n := strings.Compare(a.Folder(), b.Folder()); n != 0 {
+			return n
+		}
+		return strings.Compare(a.BaseName(), b.BaseName())
+	})
+}
+
+// nameのリクエストの位置。なければ-1を返す。
+func (c *Collection) Index(name string) int {
+	return slices.IndexFunc(c.Requests, func(r SavedRequest) bool {
+		return r.Name == name
+	})
+}
+
+// 名前の前後の空白と、フォルダの区切りの前後の空白を取り除く。
+func cleanRequestName(name string) (string, error) {
+	parts := strings.Split(name, "/")
+	for i, p := range parts {
+		parts[i] = strings.TrimSpace(p)
+		if parts[i] == "" {
+			return "", fmt.Errorf("invalid request name %q", name)
+		}
+	}
+	return strings.Join(parts, "/"), nil
+}
+
+// rを保存する。同じ名前のリクエストがあれば置き換える。
+func (c *Collection) Put(r SavedRequest) error {
+	name, err := cleanRequestName(r.Name)
+	if err != nil {
+		return err
+	}
+	r.Name = name
+	r.Headers = slices.Clone(r.Headers)
+
+	if i := c.Index(r.Name); i >= 0 {
+		c.Requests[i] = r
+	} else {
+		c.Requests = append(c.Requests, r)
+	}
+	c.sort()
+	return nil
+}
+
+func (c *Collection) Delete(name string) {
+	if i := c.Index(name); i >= 0 {
+		c.Requests = slices.Delete(c.Requests, i, i+1)
+	}
+}
+
+// nameのリクエストの名前をnewNameに変える。
+func (c *Collection) Rename(name, newName string) error {
+	newName, err := cleanRequestName(newName)
+	if err != nil {
+		return err
+	}
+	i := c.Index(name)
+	if i < 0 {
+		return fmt.Errorf("no such request %q", name)
+	}
+	if newName != name && c.Index(newName) >= 0 {
+		return fmt.Errorf("request %q already exists", newName)
+	}
+
+	c.Requests[i].Name = newName
+	c.sort()
+	return nil
+}
+
+// nameのリクエストを"name copy"のような空いている名前で複製し、その名前を返す。
+func (c *Collection) Duplicate(name string) (string, error) {
+	i := c.Index(name)
+	if i < 0 {
+		return "", fmt.Errorf("no such request %q", name)
+	}
+
+	r := c.Requests[i]
+	r.Name = name + " copy"
+	for n := 2; c.Index(r.Name) >= 0; n++ {
+		r.Name = fmt.Sprintf("%s copy %d", name, n)
+	}
+	return r.Name, c.Put(r)
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"strings"
+)
+
+// 複数行のテキストを編集する。REQUEST BODYの入力に使う。
+// カーソルの位置はrow行目のcol文字目(runeの位置)で持ち、書記素クラスタの単位で動かす。
+type TextEditor struct {
+	lines    [][]rune
+	row, col int
+
+	// 表示している範囲の左上。leftは表示上の桁数。カーソルが見えるようにRenderで動かす。
+	top, left int
+	height    int // 最後に描画したときの行数
+}
+
+func NewTextEditor(text string) *TextEditor {
+	e := &TextEditor{}
+	e.SetText(text)
+	return e
+}
+
+// 内容を置き換え、カーソルを末尾に置く。
+func (e *TextEditor) SetText(text string) {
+	e.lines = nil
+	for _, l := range strings.Split(text, "\n") {
+		e.lines = append(e.lines, []rune(l))
+	}
+	e.row = len(e.lines) - 1
+	e.col = len(e.lines[e.row])
+	e.top, e.left = 0, 0
+}
+
+func (e *TextEditor) String() string {
+	lines := make([]string, len(e.lines))
+	for i, l := range e.lines {
+		lines[i] = string(l)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// カーソルの位置にテキストを挿入する。改行(CRLF, CRも含む)で行を分け、タブ以外の制御文字は捨てる。
+func (e *TextEditor) InsertText(text string) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	for i, l := range strings.Split(text, "\n") {
+		if i > 0 {
+			e.insertNewline()
+		}
+		for _, r := range l {
+			if r >= ' ' && r != 0x7f || r == '\t' {
+				e.insertRune(r)
+			}
+		}
+	}
+}
+
+func (e *TextEditor) insertRune(r rune) {
+	line := e.lines[e.row]
+	line = append(line[:e.col], append([]rune{r}, line[e.col:]...)...)
+	e.lines[e.row] = line
+	e.col++
+}
+
+// カーソルの位置で行を分ける。
+func (e *TextEditor) insertNewline() {
+	line := e.lines[e.row]
+	rest := append([]rune{}, line[e.col:]...)
+	e.lines[e.row] = line[:e.col]
+
+	e.lines = append(e.lines[:e.row+1], append([][]rune{rest}, e.lines[e.row+1:]...)...)
+	e.row++
+	e.col = 0
+}
+
+// カーソルの前の1文字(書記素クラスタ)を消す。行頭なら前の行とつなげる。
+func (e *TextEditor) backspace() {
+	if e.col > 0 {
+		line := e.lines[e.row]
+		prev := prevBoundary(line, e.col)
+		e.lines[e.row] = append(line[:prev], line[e.col:]...)
+		e.col = prev
+		return
+	}
+
+	if e.row == 0 {
+		return
+	}
+	prev := e.lines[e.row-1]
+	e.col = len(prev)
+	e.lines[e.row-1] = append(prev, e.lines[e.row]...)
+	e.lines = append(e.lines[:e.row], e.lines[e.row+1:]...)
+	e.row--
+}
+
+// カーソルの後の1文字(書記素クラスタ)を消す。行末なら次の行とつなげる。
+func (e *TextEditor) delete() {
+	line := e.lines[e.row]
+	if e.col < len(line) {
+		e.lines[e.row] = append(line[:e.col], line[nextBoundary(line, e.col):]...)
+		return
+	}
+
+	if e.row == len(e.lines)-1 {
+		return
+	}
+	e.lines[e.row] = append(line, e.lines[e.row+1]...)
+	e.lines = append(e.lines[:e.row+1], e.lines[e.row+2:]...)
+}
+
+// キー入力を処理する。編集や移動に使わないキーならfalseを返す。
+func (e *TextEditor) HandleKey(k Key) bool {
+	switch k.Code {
+	case KeyRune:
+		switch {
+		case k.Rune == rune(CtrlU):
+			// カーソルより前を消す。
+			e.lines[e.row] = e.lines[e.row][e.col:]
+			e.col = 0
+		case k.Rune >= ' ':
+			e.insertRune(k.Rune)
+		default:
+			return false
+		}
+	case KeyPaste:
+		e.InsertText(k.Text)
+	case KeyEnter:
+		e.insertNewline()
+	case KeyBackspace:
+		e.backspace()
+	case KeyDelete:
+		e.delete()
+	case KeyLeft:
+		if e.col > 0 {
+			e.col = prevBoundary(e.lines[e.row], e.col)
+		} else if e.row > 0 {
+			e.row--
+			e.col = len(e.lines[e.row])
+		}
+	case KeyRight:
+		if e.col < len(e.lines[e.row]) {
+			e.col = nextBoundary(e.lines[e.row], e.col)
+		} else if e.row < len(e.lines)-1 {
+			e.row++
+			e.col = 0
+		}
+	case KeyUp:
+		e.moveRow(-1)
+	case KeyDown:
+		e.moveRow(1)
+	case KeyPgUp:
+		e.moveRow(-max(1, e.height-1))
+	case KeyPgDn:
+		e.moveRow(max(1, e.height-1))
+	case KeyHome:
+		e.col = 0
+	case KeyEnd:
+		e.col = len(e.lines[e.row])
+	default:
+		return false
+	}
+
+	return true
+}
+
+// n行移動する。カーソルは表示上で同じ桁にある文字に置く。
+func (e *TextEditor) moveRow(n int) {
+	x := runesWidth(e.lines[e.row][:e.col])
+	e.row = max(0, min(len(e.lines)-1, e.row+n))
+	e.col = indexAtColumn(e.lines[e.row], x)
+}
+
+// width x heightの範囲に見えている行を返す。カーソルが範囲の外にあればスクロールする。
+// cursorRow, cursorColは範囲の左上を0とした、カーソルの表示位置。
+func (e *TextEditor) Render(width, height int) (lines []string, cursorRow, cursorCol int) {
+	e.height = height
+
+	if e.row < e.top {
+		e.top = e.row
+	}
+	if e.row >= e.top+height {
+		e.top = e.row - height + 1
+	}
+
+	// カーソルの分の1桁は空けておく。
+	x := runesWidth(e.lines[e.row][:e.col])
+	if x < e.left {
+		e.left = x
+	}
+	if x >= e.left+width {
+		e.left = x - width + 1
+	}
+
+	for i := e.top; i < min(e.top+height, len(e.lines)); i++ {
+		line := []rune(sanitize(string(e.lines[i])))
+		lines = append(lines, sliceColumns(line, e.left, width))
+	}
+
+	return lines, e.row - e.top, x - e.left
+}
+
+// 1行のテキストを編集する。リクエストラインやヘッダーの欄の入力に使う。
+type LineEditor struct {
+	text []rune
+	pos  int // カーソルの位置(rune)
+	left int // 表示している範囲の左端の桁
+}
+
+func NewLineEditor(text string) *LineEditor {
+	e := &LineEditor{}
+	e.SetText(text)
+	return e
+}
+
+// 内容を置き換え、カーソルを末尾に置く。
+func (e *LineEditor) SetText(text string) {
+	e.text = nil
+	e.pos = 0
+	e.left = 0
+	e.insert(text)
+}
+
+func (e *LineEditor) String() string {
+	return string(e.text)
+}
+
+// カーソルが末尾にあるか。
+func (e *LineEditor) AtEnd() bool {
+	return e.pos == len(e.text)
+}
+
+// カーソルの位置にテキストを挿入する。1行なので改行やタブは空白にし、それ以外の制御文字は捨てる。
+func (e *LineEditor) insert(text string) {
+	var rs []rune
+	for _, r := range text {
+		if r == '\r' || r == '\n' || r == '\t' {
+			r = ' '
+		}
+		if r >= ' ' && r != 0x7f {
+			rs = append(rs, r)
+		}
+	}
+	e.text = append(e.text[:e.pos], append(rs, e.text[e.pos:]...)...)
+	e.pos += len(rs)
+}
+
+// キー入力を処理する。編集や移動に使わないキーならfalseを返す。
+func (e *LineEditor) HandleKey(k Key) bool {
+	switch k.Code {
+	case KeyRune:
+		switch {
+		case k.Rune == rune(CtrlU):
+			// カーソルより前を消す。
+			e.text = e.text[e.pos:]
+			e.pos = 0
+		case k.Rune >= ' ':
+			e.insert(string(k.Rune))
+		default:
+			return false
+		}
+	case KeyPaste:
+		e.insert(k.Text)
+	case KeyBackspace:
+		prev := prevBoundary(e.text, e.pos)
+		e.text = append(e.text[:prev], e.text[e.pos:]...)
+		e.pos = prev
+	case KeyDelete:
+		next := nextBoundary(e.text, e.pos)
+		e.text = append(e.text[:e.pos], e.text[next:]...)
+	case KeyLeft:
+		e.pos = prevBoundary(e.text, e.pos)
+	case KeyRight:
+		e.pos = nextBoundary(e.text, e.pos)
+	case KeyHome:
+		e.pos = 0
+	case KeyEnd:
+		e.pos = len(e.text)
+	default:
+		return false
+	}
+
+	return true
+}
+
+// 1行の入力欄として描画する。heightは使わない。
+func (e *LineEditor) Render(width, height int) (lines []string, cursorRow, cursorCol int) {
+	line, col := e.view(width)
+	return []string{line}, 0, col
+}
+
+// width桁に見えている部分と、その左端を0としたカーソルの桁を返す。
+// カーソルが範囲の外にあればスクロールする。カーソルの分の1桁は空けておく。
+func (e *LineEditor) view(width int) (line string, cursorCol int) {
+	e.left = min(e.left, max(0, runesWidth(e.text)+1-width))
+
+	x := runesWidth(e.text[:e.pos])
+	if x < e.left {
+		e.left = x
+	}
+	if x >= e.left+width {
+		e.left = x - width + 1
+	}
+
+	return sliceColumns(e.text, e.left, width), x - e.left
+}
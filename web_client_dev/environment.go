@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 環境ごとの変数。リクエストの"{{name}}"を置き換えるのに使う。
+type Environment struct {
+	Name string
+	Vars map[string]string
+}
+
+// 環境のファイルを置くディレクトリ。"<環境の名前>.env"のファイルを読む。
+func defaultEnvironmentDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "web_client", "environments"), nil
+}
+
+// dirの"*.env"を名前順に読む。dirがなければ環境はないものとする。
+func LoadEnvironments(dir string) ([]*Environment, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.env"))
+	if err != nil {
+		return nil, err
+	}
+
+	var envs []*Environment
+	for _, path := range paths {
+		env, err := loadEnvironment(path)
+		if err != nil {
+			return envs, err
+		}
+		envs = append(envs, env)
+	}
+	return envs, nil
+}
+
+// "name=value"の行を並べたファイルを読む。空行と"#"で始まる行は読み飛ばし、
+// 値を"か'で囲んでいればそれを外す。
+func loadEnvironment(path string) (*Environment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	env := &Environment{
+		Name: strings.TrimSuffix(filepath.Base(path), ".env"),
+		Vars: map[string]string{},
+	}
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !isVarName(name) {
+			return nil, fmt.Errorf("%s:%d: expected name=value: %q", path, n, line)
+		}
+
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		env.Vars[name] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return env, nil
+}
+
+// 変数の名前に使える文字は英数字と"_", "-", "."だけにする。
+func isVarName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '_' || r == '-' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// sの"{{name}}"をvarsの値に置き換える。{{と}}の内側の前後の空白は無視する。
+// 定義されていない変数があればエラーにする。
+func expandVars(s string, vars map[string]string) (string, error) {
+	var b strings.Builder
+	for {
+		start := strings.Index(s, "{{")
+		if start < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		end := strings.Index(s[start:], "}}")
+		if end < 0 {
+			return "", errors.New("unterminated \"{{\"")
+		}
+
+		name := strings.TrimSpace(s[start+2 : start+end])
+		value, ok := vars[name]
+		if !ok {
+			return "", fmt.Errorf("undefined variable %q", name)
+		}
+
+		b.WriteString(s[:start])
+		b.WriteString(value)
+		s = s[start+end+2:]
+	}
+}
+
+// request line、ヘッダー、bodyの変数を展開したRequestContentを返す。
+func (rc *RequestContent) expand(vars map[string]string) (*RequestContent, error) {
+	var err error
+	expanded := &RequestContent{}
+
+	if expanded.requestLine, err = expandVars(rc.requestLine, vars); err != nil {
+		return nil, fmt.Errorf("request line: %w", err)
+	}
+
+	for _, f := range rc.headers {
+		if !f.Enabled {
+			continue
+		}
+		// エラーには展開する前の名前を出す
+		name, err := expandVars(f.Name, vars)
+		if err != nil {
+			return nil, fmt.Errorf("header %q: %w", f.Name, err)
+		}
+		value, err := expandVars(f.Value, vars)
+		if err != nil {
+			return nil, fmt.Errorf("header %q: %w", f.Name, err)
+		}
+		expanded.headers = append(expanded.headers, HeaderField{Name: name, Value: value, Enabled: true})
+	}
+
+	if expanded.requestBody, err = expandVars(rc.requestBody, vars); err != nil {
+		return nil, fmt.Errorf("body: %w", err)
+	}
+
+	return expanded, nil
+}
+
+const (
+	CtrlE uint8 = 5
+	CtrlR uint8 = 18
+)
+
+// 選んでいる環境の変数。環境を選んでいなければnil。
+func (ab *AlternateBuffer) envVars() map[string]string {
+	if ab.env == nil {
+		return nil
+	}
+	return ab.env.Vars
+}
+
+// 環境のファイルを読み直し、次の環境に切り替える。最後の環境の次は環境なしに戻る。
+func (ab *AlternateBuffer) switchEnvironment() {
+	envs, err := ab.loadEnvironments()
+	if err != nil {
+		ab.message = fmt.Sprintf("cannot load environments: %v", err)
+		ab.drawHelp()
+		return
+	}
+
+	next := 0
+	if ab.env != nil {
+		for i, env := range envs {
+			if env.Name == ab.env.Name {
+				next = i + 1
+			}
+		}
+	}
+
+	ab.env = nil
+	ab.message = "no environment"
+	if next < len(envs) {
+		ab.env = envs[next]
+		ab.message = fmt.Sprintf("environment: %s", ab.env.Name)
+	}
+	ab.draw()
+}
+
+func (ab *AlternateBuffer) loadEnvironments() ([]*Environment, error) {
+	dir, err := defaultEnvironmentDir()
+	if err != nil {
+		return nil, err
+	}
+	return LoadEnvironments(dir)
+}
+
+// 変数を展開したリクエストを実際に送る形で表示する行。先頭に見出しと区切り線を置く。
+func (ab *AlternateBuffer) previewLines(width int) []string {
+	env := "none"
+	if ab.env != nil {
+		env = ab.env.Name
+	}
+	lines := []string{
+		fmt.Sprintf("PREVIEW  env: %s  (^R: close)", env),
+		strings.Repeat("─", width),
+	}
+
+	client, req, err := ab.buildRequest()
+	var msg []byte
+	if err == nil {
+		ab.configureClient(client)
+		msg, err = req.encode(client.hostHeader(), client.pool != nil)
+	}
+	if err != nil {
+		return append(lines, "ERROR", err.Error())
+	}
+
+	for _, l := range strings.Split(strings.ReplaceAll(string(msg), "\r\n", "\n"), "\n") {
+		lines = append(lines, sanitize(l))
+	}
+	return lines
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+)
+
+// リクエストが失敗した理由の種類。errors.Is(err, ErrTimeout)のように調べる。
+var (
+	ErrDNS               = errors.New("DNS lookup failed")
+	ErrConnectionRefused = errors.New("connection refused")
+	ErrTimeout           = errors.New("timeout")
+	ErrCanceled          = errors.New("canceled")
+	ErrTLS               = errors.New("TLS error")
+	ErrProtocol          = errors.New("protocol violation")
+	ErrMalformedResponse = errors.New("malformed response")
+	ErrNetwork           = errors.New("network error")
+)
+
+// リクエストのどの段階で失敗したか。
+type Stage string
+
+const (
+	StageDNS        Stage = "resolve"
+	StageConnect    Stage = "connect"
+	StageTLS        Stage = "TLS handshake"
+	StageWrite      Stage = "write request"
+	StageReadHeader Stage = "read response header"
+	StageReadBody   Stage = "read response body"
+)
+
+// HTTPClientが返すエラー。失敗した段階と理由の種類、元のエラーを持つ。
+type RequestError struct {
+	Stage   Stage
+	Kind    error // ErrDNSなど
+	Address string
+	Err     error
+}
+
+func (e *RequestError) Error() string {
+	if e.Address == "" {
+		return fmt.Sprintf("%s: %v: %v", e.Stage, e.Kind, e.Err)
+	}
+	return fmt.Sprintf("%s %s: %v: %v", e.Stage, e.Address, e.Kind, e.Err)
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RequestError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// stageで起きたerrをRequestErrorにする。kindがnilなら元のエラーから種類を決める。
+func newRequestError(stage Stage, address string, kind, err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	var re *RequestError
+	if errors.As(err, &re) {
+		return err
+	}
+	if kind == nil {
+		kind = classifyError(err)
+	}
+	return &RequestError{Stage: stage, Kind: kind, Address: address, Err: err}
+}
+
+// ネットワークのエラーの種類を決める。
+func classifyError(err error) error {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ErrCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrTimeout
+	case errors.As(err, &dnsErr):
+		if dnsErr.IsTimeout {
+			return ErrTimeout
+		}
+		return ErrDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrConnectionRefused
+	case errors.Is(err, os.ErrDeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ErrTimeout
+	case errors.As(err, &recordErr), errors.As(err, &alertErr), errors.As(err, &certErr), errors.As(err, &unknownAuthority):
+		return ErrTLS
+	case errors.Is(err, errMalformedHeader):
+		return ErrMalformedResponse
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, errMalformedChunk):
+		return ErrProtocol
+	}
+	return ErrNetwork
+}
+
+// ctxが終わっていたためにerrになったのなら、その理由をエラーの種類にする。
+// キャンセルされた接続の読み書きは期限切れで失敗するので、そのままではErrTimeoutになってしまう。
+func contextError(ctx context.Context, err error) error {
+	var re *RequestError
+	if ctx.Err() == nil || !errors.As(err, &re) {
+		return err
+	}
+	re.Kind = classifyError(ctx.Err())
+	return err
+}
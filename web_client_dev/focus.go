@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// フォーカスを受け取る部品。Tabで次の、Shift-Tabで前の部品に移る。
+type focusID int
+
+const (
+	focusCollection focusID = iota
+	focusRequestLine
+	focusHeader
+	focusBody
+	focusSend
+	focusCancel
+
+	focusCount
+)
+
+// フォーカスを受け取り、キー入力を処理して自分の領域を描画する部品。
+type widget interface {
+	// キー入力を処理する。表示が変わらないキーならfalseを返す。
+	HandleKey(k Key) bool
+	// width x heightの範囲に描画する行と、範囲の左上を0としたカーソルの位置を返す。
+	Render(width, height int) (lines []string, cursorRow, cursorCol int)
+}
+
+// SENDやCANCELのボタン。フォーカスがあるときはラベルを反転する。
+// Enterで押したときの動作はAlternateBufferが決める。
+type Button struct {
+	Label   string
+	Frame   string // ラベルの両側に置く文字
+	focused bool
+}
+
+func (b *Button) HandleKey(k Key) bool {
+	return false
+}
+
+func (b *Button) Render(width, height int) ([]string, int, int) {
+	label := b.Label
+	if b.focused {
+		label = inverse + label + resetStyle
+	}
+
+	pad := max(0, width-2-len(b.Label))
+	line := b.Frame + strings.Repeat(" ", pad/2) + label + strings.Repeat(" ", pad-pad/2) + b.Frame
+	return []string{line}, 0, 0
+}
+
+func (ab *AlternateBuffer) widget(f focusID) widget {
+	switch f {
+	case focusCollection:
+		return ab.collection
+	case focusRequestLine:
+		return ab.line
+	case focusHeader:
+		return ab.headers
+	case focusBody:
+		return ab.body
+	case focusSend:
+		return ab.send
+	}
+	return ab.cancel
+}
+
+func (l *screenLayout) rect(f focusID) Rect {
+	switch f {
+	case focusCollection:
+		return l.collection
+	case focusRequestLine:
+		return l.requestLine
+	case focusHeader:
+		return l.header
+	case focusBody:
+		return l.body
+	case focusSend:
+		return l.send
+	}
+	return l.cancel
+}
+
+// フォーカスをdeltaだけ先の部品に移す。サイドバーを出していなければ飛ばす。
+func (ab *AlternateBuffer) moveFocus(delta focusID) {
+	f := ab.focus
+	for {
+		f = (f + delta + focusCount) % focusCount
+		if f != focusCollection || ab.layout.hasSidebar {
+			break
+		}
+	}
+	ab.setFocus(f)
+}
+
+// フォーカスをfに移す。前後の部品と操作説明だけを描き直す。
+func (ab *AlternateBuffer) setFocus(f focusID) {
+	prev := ab.focus
+	ab.focus = f
+	ab.collection.focused = f == focusCollection
+	ab.send.focused = f == focusSend
+	ab.cancel.focused = f == focusCancel
+
+	if ab.layout.tooSmall {
+		return
+	}
+	ab.drawWidget(prev)
+	ab.drawHelp()
+	ab.placeCursor()
+}
+
+// 1回のキー入力を処理する。終了するときはtrueを返す。
+func (ab *AlternateBuffer) handleKey(k Key) bool {
+	// 前の操作の結果のメッセージは、次のキー入力で消す。
+	if ab.message != "" {
+		ab.message = ""
+		ab.drawHelp()
+	}
+
+	if ab.prompt != nil {
+		ab.handlePromptKey(k)
+		ab.drawWidget(focusCollection)
+		if ab.mode == modeHistory {
+			ab.drawResponse()
+		} else {
+			ab.drawHelp()
+			ab.placeCursor()
+		}
+		return false
+	}
+
+	// 送っている途中はEscでやめるほかの操作を受け付けない。
+	if ab.cancelRequest != nil {
+		if k.Code == KeyEsc {
+			ab.cancelRequest()
+		}
+		return false
+	}
+
+	if ab.mode == modeHistory {
+		ab.handleHistoryKey(k)
+		return false
+	}
+	if k.Code == KeyRune && k.Rune == rune(CtrlY) {
+		ab.openHistory()
+		return false
+	}
+
+	if ab.mode == modeResponse {
+		edit, quit := ab.viewer.HandleKey(k)
+		switch {
+		case quit:
+			return true
+		case edit:
+			ab.mode = modeInput
+			ab.focus = focusRequestLine
+			ab.send.focused = false
+			ab.draw()
+		default:
+			ab.drawResponse()
+		}
+		return false
+	}
+
+	switch {
+	case k.Code == KeyTab:
+		ab.moveFocus(1)
+	case k.Code == KeyBacktab:
+		ab.moveFocus(-1)
+	case k.Code == KeyRune && k.Rune == rune(CtrlB):
+		ab.toggleSidebar()
+	case k.Code == KeyRune && k.Rune == rune(CtrlE):
+		ab.switchEnvironment()
+	case k.Code == KeyRune && k.Rune == rune(CtrlR):
+		ab.preview = !ab.preview
+		ab.drawResponse()
+	case k.Code == KeyRune && k.Rune == rune(CtrlS):
+		if ab.collection.loaded != "" {
+			ab.saveRequest(ab.collection.loaded)
+		} else {
+			ab.ask("Save as: ", "", ab.saveRequest)
+		}
+		ab.drawWidget(focusCollection)
+		ab.drawHelp()
+		ab.placeCursor()
+	case ab.focus == focusCollection && ab.handleCollectionKey(k):
+		ab.drawWidget(focusCollection)
+		ab.drawHelp()
+		ab.placeCursor()
+	case ab.focus == focusSend && k.Code == KeyEnter:
+		ab.sendRequest()
+	case ab.focus == focusCancel && k.Code == KeyEnter:
+		return true
+	case ab.focus >= focusSend && (k.Code == KeyLeft || k.Code == KeyRight):
+		ab.setFocus(focusSend + focusCancel - ab.focus)
+	default:
+		if ab.widget(ab.focus).HandleKey(k) {
+			ab.syncRequest()
+			if ab.preview {
+				ab.drawResponse()
+			} else {
+				ab.placeCursor()
+			}
+		}
+	}
+	return false
+}
+
+// 入力欄の内容をRequestContentに写す。
+func (ab *AlternateBuffer) syncRequest() {
+	ab.rc.requestLine = ab.line.String()
+	ab.rc.headers = ab.headers.Fields()
+	ab.rc.requestBody = ab.body.String()
+}
+
+// 入力されたリクエストを送り始める。
+func (ab *AlternateBuffer) sendRequest() {
+	client, req, err := ab.buildRequest()
+	if err != nil {
+		ab.showResponse(nil, err)
+		return
+	}
+	ab.configureClient(client)
+	ab.startRequest(client, req)
+}
+
+// レスポンスか送れなかった理由を表示する。履歴に記録できなければそれも知らせる。
+func (ab *AlternateBuffer) showResponse(resp *Response, err error) {
+	ab.viewer = NewResponseViewer(resp, err)
+	ab.mode = modeResponse
+	if ab.history != nil && ab.history.Err() != nil {
+		ab.message = fmt.Sprintf("cannot write history: %v", ab.history.Err())
+	}
+	ab.draw()
+}
+
+// 部品を描画し、カーソルを置く位置を返す。
+func (ab *AlternateBuffer) drawWidget(f focusID) (row, col int) {
+	r := ab.layout.rect(f)
+	if r.Width <= 0 || r.Height <= 0 {
+		return r.Row, r.Col
+	}
+	lines, cursorRow, cursorCol := ab.widget(f).Render(r.Width, r.Height)
+	fmt.Print(fillLines(r, lines))
+	return r.Row + cursorRow, r.Col + cursorCol
+}
+
+// フォーカスのある部品を描き直し、カーソルを置く。
+// 入力中のpromptがあればそこに置き、サイドバーやボタン、レスポンスを見ているときはカーソルを隠す。
+func (ab *AlternateBuffer) placeCursor() {
+	if ab.layout.tooSmall {
+		return
+	}
+
+	row, col := ab.drawWidget(ab.focus)
+	switch {
+	case ab.prompt != nil:
+		row, col = ab.drawPrompt()
+	case ab.mode != modeInput, ab.focus == focusCollection, ab.focus >= focusSend:
+		ab._hiddenCursor()
+		return
+	}
+	ab.moveCursor(row, col)
+	ab._visibleCursor()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"strings"
+)
+
+// HTTPヘッダー。キーは正規化された形(e.g. Content-Type)で保持するので、
+// Get/Valuesには大文字小文字を気にせず名前を渡せる。
+type Header map[string][]string
+
+// 値を追加する。同じ名前のヘッダーが複数あれば全て保持する。
+func (h Header) Add(key, value string) {
+	key = canonicalHeaderKey(key)
+	h[key] = append(h[key], value)
+}
+
+// 既存の値を置き換える。
+func (h Header) Set(key, value string) {
+	h[canonicalHeaderKey(key)] = []string{value}
+}
+
+// 最初の値を返す。なければ空文字。
+func (h Header) Get(key string) string {
+	v := h[canonicalHeaderKey(key)]
+	if len(v) == 0 {
+		return ""
+	}
+	return v[0]
+}
+
+// 全ての値を返す。
+func (h Header) Values(key string) []string {
+	return h[canonicalHeaderKey(key)]
+}
+
+func (h Header) Del(key string) {
+	delete(h, canonicalHeaderKey(key))
+}
+
+// ヘッダー名を先頭と'-'の直後だけ大文字にした形にそろえる。
+func canonicalHeaderKey(key string) string {
+	b := []byte(strings.ToLower(key))
+	upper := true
+	for i, c := range b {
+		if upper && 'a' <= c && c <= 'z' {
+			b[i] = c - ('a' - 'A')
+		}
+		upper = c == '-'
+	}
+	return string(b)
+}
+
+// "Name: value"の行を名前順に並べて返す。
+func (h Header) lines() []string {
+	var lines []string
+	for _, k := range slices.Sorted(maps.Keys(h)) {
+		for _, v := range h[k] {
+			lines = append(lines, k+": "+v)
+		}
+	}
+	return lines
+}
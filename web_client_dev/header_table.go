@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// よく使うヘッダー名。名前の入力中に補完の候補として出す。
+var commonHeaderNames = []string{
+	"Accept",
+	"Accept-Charset",
+	"Accept-Encoding",
+	"Accept-Language",
+	"Authorization",
+	"Cache-Control",
+	"Connection",
+	"Content-Encoding",
+	"Content-Language",
+	"Content-Length",
+	"Content-Type",
+	"Cookie",
+	"Date",
+	"Expect",
+	"Forwarded",
+	"From",
+	"Host",
+	"If-Match",
+	"If-Modified-Since",
+	"If-None-Match",
+	"If-Range",
+	"If-Unmodified-Since",
+	"Origin",
+	"Pragma",
+	"Range",
+	"Referer",
+	"TE",
+	"Upgrade",
+	"User-Agent",
+	"Via",
+	"X-Api-Key",
+	"X-Forwarded-For",
+	"X-Forwarded-Host",
+	"X-Forwarded-Proto",
+	"X-Request-Id",
+	"X-Requested-With",
+}
+
+const (
+	dim      = "\x1b[2m"
+	resetDim = "\x1b[22m"
+)
+
+const (
+	CtrlA uint8 = 1
+	CtrlN uint8 = 14
+	CtrlP uint8 = 16
+	CtrlT uint8 = 20
+	CtrlX uint8 = 24
+)
+
+// リクエストヘッダーの1行。Enabledがfalseの行は送らない。
+type HeaderField struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	Enabled bool   `json:"enabled"`
+}
+
+// ヘッダーの一覧を表で編集する。
+// 選んでいる行のname/valueのどちらかの欄をcellで編集する。
+type HeaderTable struct {
+	rows      []HeaderField
+	row       int
+	editValue bool // trueならvalueの欄を編集している
+	cell      *LineEditor
+	top       int
+}
+
+// rowsは複製して持つので、編集しても呼び出し元のsliceは変わらない。
+func NewHeaderTable(rows []HeaderField) *HeaderTable {
+	t := &HeaderTable{rows: slices.Clone(rows)}
+	if len(t.rows) == 0 {
+		t.rows = []HeaderField{{Enabled: true}}
+	}
+	t.selectRow(0)
+	return t
+}
+
+// i行目を選ぶ。名前が入っている行ならvalueの欄から編集する。
+func (t *HeaderTable) selectRow(i int) {
+	t.row = max(0, min(len(t.rows)-1, i))
+	t.editValue = t.rows[t.row].Name != ""
+	t.cell = NewLineEditor(*t.current())
+}
+
+// 編集している欄。
+func (t *HeaderTable) current() *string {
+	if t.editValue {
+		return &t.rows[t.row].Value
+	}
+	return &t.rows[t.row].Name
+}
+
+func (t *HeaderTable) Fields() []HeaderField {
+	return append([]HeaderField{}, t.rows...)
+}
+
+// 名前の末尾を入力中なら、入力した文字で始まる最初の候補を返す。
+func (t *HeaderTable) suggestion() string {
+	name := t.rows[t.row].Name
+	if t.editValue || name == "" || !t.cell.AtEnd() {
+		return ""
+	}
+
+	var candidate string
+	for _, c := range commonHeaderNames {
+		if strings.EqualFold(c, name) {
+			return ""
+		}
+		if candidate == "" && len(c) > len(name) && strings.EqualFold(c[:len(name)], name) {
+			candidate = c
+		}
+	}
+	return candidate
+}
+
+// キー入力を処理する。使わないキーならfalseを返す。
+func (t *HeaderTable) HandleKey(k Key) bool {
+	switch {
+	case k.Code == KeyUp:
+		t.selectRow(t.row - 1)
+	case k.Code == KeyDown:
+		t.selectRow(t.row + 1)
+	case k.Code == KeyEnter:
+		// 名前の欄では補完を確定してvalueの欄へ、valueの欄では名前の欄へ移る。
+		if s := t.suggestion(); s != "" {
+			*t.current() = s
+		}
+		t.editValue = !t.editValue
+		t.cell = NewLineEditor(*t.current())
+	case k.Code == KeyRune && k.Rune == rune(CtrlA):
+		t.rows = append(t.rows[:t.row+1], append([]HeaderField{{Enabled: true}}, t.rows[t.row+1:]...)...)
+		t.selectRow(t.row + 1)
+	case k.Code == KeyRune && k.Rune == rune(CtrlX):
+		t.rows = append(t.rows[:t.row], t.rows[t.row+1:]...)
+		if len(t.rows) == 0 {
+			t.rows = []HeaderField{{Enabled: true}}
+		}
+		t.selectRow(t.row)
+	case k.Code == KeyRune && k.Rune == rune(CtrlT):
+		t.rows[t.row].Enabled = !t.rows[t.row].Enabled
+	case k.Code == KeyRune && k.Rune == rune(CtrlP):
+		if t.row > 0 {
+			t.rows[t.row-1], t.rows[t.row] = t.rows[t.row], t.rows[t.row-1]
+			t.row--
+		}
+	case k.Code == KeyRune && k.Rune == rune(CtrlN):
+		if t.row < len(t.rows)-1 {
+			t.rows[t.row+1], t.rows[t.row] = t.rows[t.row], t.rows[t.row+1]
+			t.row++
+		}
+	default:
+		if !t.cell.HandleKey(k) {
+			return false
+		}
+		*t.current() = t.cell.String()
+	}
+
+	return true
+}
+
+// width x heightの範囲に見えている行を返す。選んでいる行が範囲の外にあればスクロールする。
+// cursorRow, cursorColは範囲の左上を0とした、編集中の欄のカーソルの位置。
+func (t *HeaderTable) Render(width, height int) (lines []string, cursorRow, cursorCol int) {
+	if t.row < t.top {
+		t.top = t.row
+	}
+	if t.row >= t.top+height {
+		t.top = t.row - height + 1
+	}
+
+	// "[x] name: value"の形で並べる。nameの幅はそろえる。
+	nameWidth := min(20, max(4, (width-6)/3))
+	valueWidth := width - 6 - nameWidth
+
+	for i := t.top; i < min(t.top+height, len(t.rows)); i++ {
+		f := t.rows[i]
+		check := "[ ]"
+		if f.Enabled {
+			check = "[x]"
+		}
+
+		name := fieldTail(f.Name, nameWidth+1)
+		value := fieldTail(f.Value, valueWidth)
+		if i == t.row {
+			cursorRow = i - t.top
+			if t.editValue {
+				var col int
+				value, col = t.cell.view(valueWidth)
+				cursorCol = 4 + nameWidth + 2 + col
+			} else {
+				var col int
+				name, col = t.cell.view(nameWidth)
+				cursorCol = 4 + col
+			}
+		}
+
+		nameCell := padRight(name, nameWidth)
+		if s := t.suggestion(); i == t.row && f.Enabled && s != "" {
+			// 補完の候補の残りの部分を薄く表示する。
+			rest := fitWidth(s[len(f.Name):], nameWidth-stringWidth(name))
+			nameCell = name + dim + rest + resetDim + strings.Repeat(" ", nameWidth-stringWidth(name+rest))
+		}
+
+		line := fmt.Sprintf("%s %s: %s", check, nameCell, value)
+		if !f.Enabled {
+			line = dim + line + resetDim
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, cursorRow, cursorCol
+}
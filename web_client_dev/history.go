@@ -0,0 +1,459 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 履歴に残す件数。古いものから捨てる。
+const maxHistoryEntries = 1000
+
+// 追記のたびに書き直さないように、これだけ超えてからmaxHistoryEntries件に切り詰める。
+const historyTrimSlack = maxHistoryEntries / 10
+
+// 送ったリクエスト1件の記録。リクエストはそのまま送り直せるように全て残す。
+type HistoryEntry struct {
+	Time       time.Time `json:"time"`
+	Scheme     string    `json:"scheme,omitempty"` // 空ならhttp
+	Address    string    `json:"address"`          // 接続先のhost:port
+	Method     string    `json:"method"`
+	Target     string    `json:"target"`
+	Header     Header    `json:"header"`
+	Body       string    `json:"body"`
+	Status     int       `json:"status,omitempty"` // レスポンスを受け取れなければ0
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"durationMs"`
+	Size       int64     `json:"size"` // 受け取ったレスポンスメッセージのバイト数
+}
+
+// 履歴のファイル。1行に1件ずつJSONで追記する。
+// ヘッダーにはAuthorizationなどの秘密も含まれるので、本人しか読めないように作る。
+type History struct {
+	path string
+
+	mu    sync.Mutex
+	err   error // 最後に追記したときのエラー
+	lines int   // ファイルの行数。-1なら数えていない
+}
+
+// 履歴のファイルの場所。コレクションと同じディレクトリに置く。
+func defaultHistoryPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "web_client", "history.jsonl"), nil
+}
+
+func NewHistory(path string) *History {
+	return &History{path: path, lines: -1}
+}
+
+// cがreqを送った結果を追記する。失敗してもリクエストの結果には影響させず、Errで知らせる。
+func (h *History) record(c HTTPClient, req *Request, resp *Response, err error, start time.Time) {
+	header := Header{}
+	for k, v := range req.Header {
+		header[k] = slices.Clone(v)
+	}
+	if header.Get("Host") == "" {
+		header.Set("Host", c.hostHeader())
+	}
+
+	e := HistoryEntry{
+		Time:       start,
+		Address:    c.address,
+		Method:     req.Method,
+		Target:     req.Target,
+		Header:     header,
+		Body:       string(req.Body),
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if c.useTLS {
+		e.Scheme = "https"
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	if resp != nil {
+		e.Status = resp.StatusCode()
+		e.Size = resp.Size()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.err = h.append(e)
+}
+
+func (h *History) append(e HistoryEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	// 以前に誰でも読めるように作ったファイルも本人だけにする
+	if err := f.Chmod(0o600); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if h.lines < 0 {
+		if h.lines, err = h.countLines(); err != nil {
+			return err
+		}
+	} else {
+		h.lines++
+	}
+	if h.lines > maxHistoryEntries+historyTrimSlack {
+		return h.trim()
+	}
+	return nil
+}
+
+func (h *History) countLines() (int, error) {
+	b, err := os.ReadFile(h.path)
+	if err != nil {
+		return 0, err
+	}
+	return bytes.Count(b, []byte("\n")), nil
+}
+
+// 新しいmaxHistoryEntries行だけを残す。途中で失敗しても元のファイルが残るように、別のファイルに書いてから置き換える。
+func (h *History) trim() error {
+	b, err := os.ReadFile(h.path)
+	if err != nil {
+		return err
+	}
+	lines := bytes.SplitAfter(b, []byte("\n"))
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > maxHistoryEntries {
+		lines = lines[len(lines)-maxHistoryEntries:]
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(h.path), ".history-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(bytes.Join(lines, nil)); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), h.path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	h.lines = len(lines)
+	return nil
+}
+
+// 最後に追記したときのエラー。
+func (h *History) Err() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.err
+}
+
+// 履歴を新しい順に読む。壊れた行は読み飛ばす。
+func (h *History) Load() ([]HistoryEntry, error) {
+	f, err := os.Open(h.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []HistoryEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		var e HistoryEntry
+		if json.Unmarshal(scanner.Bytes(), &e) != nil {
+			continue
+		}
+		entries = append(entries, e)
+		if len(entries) > maxHistoryEntries {
+			entries = entries[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", h.path, err)
+	}
+
+	slices.Reverse(entries)
+	return entries, nil
+}
+
+// 記録したリクエストを送り直すためのHTTPClientとRequest。
+func (e HistoryEntry) request() (*HTTPClient, *Request, error) {
+	host, port, err := net.SplitHostPort(e.Address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := NewRequest(e.Method, e.Target, []byte(e.Body))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header = Header{}
+	for k, v := range e.Header {
+		req.Header[k] = slices.Clone(v)
+	}
+
+	if e.Scheme == "https" {
+		return NewHTTPSClient(host, port), req, nil
+	}
+	return NewHTTPClient(host, port), req, nil
+}
+
+// 入力欄に写すためのRequestContent。Hostを先頭に、ほかのヘッダーは名前順に並べる。
+func (e HistoryEntry) content() *RequestContent {
+	rc := &RequestContent{
+		requestLine: e.Method + " " + e.Target + " HTTP/1.1",
+		headers:     []HeaderField{{Name: "Host", Value: e.Header.Get("Host"), Enabled: true}},
+		requestBody: e.Body,
+	}
+	for _, k := range slices.Sorted(maps.Keys(e.Header)) {
+		if k == "Host" {
+			continue
+		}
+		for _, v := range e.Header[k] {
+			rc.headers = append(rc.headers, HeaderField{Name: k, Value: v, Enabled: true})
+		}
+	}
+	return rc
+}
+
+// 一覧に出す1行。
+func (e HistoryEntry) summary() string {
+	status := strconv.Itoa(e.Status)
+	if e.Status == 0 {
+		status = "ERR"
+	}
+	return fmt.Sprintf("%s  %3s  %s %s%s  %dms  %dB",
+		e.Time.Local().Format("01-02 15:04:05"), status, e.Method, e.Header.Get("Host"), e.Target, e.DurationMs, e.Size)
+}
+
+// 履歴を新しい順に並べ、hostとstatusで絞り込んで選ぶ。
+type HistoryBrowser struct {
+	entries []HistoryEntry
+	host    string // 接続先に含まれる文字列
+	status  string // ステータスコードの先頭("2", "404"など)。"err"ならエラーになったもの
+	sel     int    // visibleの中での位置
+	top     int
+}
+
+// 絞り込みに合う履歴の位置。
+func (b *HistoryBrowser) visible() []int {
+	var idx []int
+	for i, e := range b.entries {
+		host := e.Address + " " + e.Header.Get("Host")
+		if b.host != "" && !strings.Contains(strings.ToLower(host), strings.ToLower(b.host)) {
+			continue
+		}
+		switch {
+		case b.status == "":
+		case strings.EqualFold(b.status, "err"):
+			if e.Status != 0 {
+				continue
+			}
+		case !strings.HasPrefix(strconv.Itoa(e.Status), b.status):
+			continue
+		}
+		idx = append(idx, i)
+	}
+	return idx
+}
+
+// 選んでいる履歴。
+func (b *HistoryBrowser) Selected() (HistoryEntry, bool) {
+	idx := b.visible()
+	if b.sel < 0 || b.sel >= len(idx) {
+		return HistoryEntry{}, false
+	}
+	return b.entries[idx[b.sel]], true
+}
+
+func (b *HistoryBrowser) HandleKey(k Key) bool {
+	switch k.Code {
+	case KeyUp:
+		b.sel--
+	case KeyDown:
+		b.sel++
+	case KeyPgUp:
+		b.sel -= 10
+	case KeyPgDn:
+		b.sel += 10
+	case KeyHome:
+		b.sel = 0
+	case KeyEnd:
+		b.sel = len(b.entries)
+	default:
+		return false
+	}
+	b.sel = max(0, min(b.sel, len(b.visible())-1))
+	return true
+}
+
+// 見出し、区切り線、一覧の順に並べる。
+func (b *HistoryBrowser) Render(width, height int) []string {
+	idx := b.visible()
+	b.sel = max(0, min(b.sel, len(idx)-1))
+
+	filter := ""
+	if b.host != "" {
+		filter += "  host: " + b.host
+	}
+	if b.status != "" {
+		filter += "  status: " + b.status
+	}
+	lines := []string{
+		fitWidth(fmt.Sprintf("HISTORY  %d/%d%s", len(idx), len(b.entries), filter), width),
+		strings.Repeat("─", width),
+	}
+
+	rows := max(1, height-len(lines))
+	if b.sel < b.top {
+		b.top = b.sel
+	}
+	if b.sel >= b.top+rows {
+		b.top = b.sel - rows + 1
+	}
+
+	if len(idx) == 0 {
+		return append(lines, dim+fitWidth("no history", width)+resetDim)
+	}
+	for i := b.top; i < min(b.top+rows, len(idx)); i++ {
+		line := padRight(fitWidth(sanitize(b.entries[idx[i]].summary()), width), width)
+		if i == b.sel {
+			line = inverse + line + resetStyle
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+const CtrlY uint8 = 25
+
+// 履歴を読み直して一覧を開く。
+func (ab *AlternateBuffer) openHistory() {
+	if ab.history == nil {
+		ab.message = "history is not available"
+		ab.drawHelp()
+		return
+	}
+	entries, err := ab.history.Load()
+	if err != nil {
+		ab.message = fmt.Sprintf("cannot load history: %v", err)
+		ab.drawHelp()
+		return
+	}
+
+	if ab.historyView == nil {
+		ab.historyView = &HistoryBrowser{}
+	}
+	ab.historyView.entries = entries
+	ab.historyView.sel = 0
+	ab.mode = modeHistory
+	ab.drawResponse()
+}
+
+// 履歴の一覧でのキー入力を処理する。
+func (ab *AlternateBuffer) handleHistoryKey(k Key) {
+	b := ab.historyView
+	e, ok := b.Selected()
+
+	switch {
+	case k.Code == KeyEsc || k.Code == KeyRune && k.Rune == 'q':
+		ab.closeHistory()
+	case k.Code == KeyRune && k.Rune == 'h':
+		ab.ask("Filter by host: ", b.host, func(s string) {
+			b.host = strings.TrimSpace(s)
+			b.sel = 0
+		})
+		ab.drawHelp()
+		ab.placeCursor()
+	case k.Code == KeyRune && k.Rune == 's':
+		ab.ask("Filter by status (e.g. 2, 404, err): ", b.status, func(s string) {
+			b.status = strings.TrimSpace(s)
+			b.sel = 0
+		})
+		ab.drawHelp()
+		ab.placeCursor()
+	case k.Code == KeyRune && k.Rune == 'x':
+		b.host, b.status, b.sel = "", "", 0
+		ab.drawResponse()
+	case !ok:
+	case k.Code == KeyEnter:
+		ab.replay(e)
+	case k.Code == KeyRune && k.Rune == 'e':
+		ab.copyToEditor(e)
+	case b.HandleKey(k):
+		ab.drawResponse()
+	}
+}
+
+// 一覧を閉じて入力欄に戻る。
+func (ab *AlternateBuffer) closeHistory() {
+	ab.mode = modeInput
+	ab.draw()
+}
+
+// 記録したリクエストをそのまま送り直す。
+func (ab *AlternateBuffer) replay(e HistoryEntry) {
+	client, req, err := e.request()
+	if err != nil {
+		ab.showResponse(nil, err)
+		return
+	}
+	ab.configureClient(client)
+	ab.startRequest(client, req)
+}
+
+// 記録したリクエストを入力欄に写す。コレクションのリクエストとは切り離す。
+func (ab *AlternateBuffer) copyToEditor(e HistoryEntry) {
+	rc := e.content()
+	ab.line.SetText(rc.requestLine)
+	ab.headers = NewHeaderTable(rc.headers)
+	ab.body.SetText(rc.requestBody)
+	ab.syncRequest()
+
+	ab.collection.loaded = ""
+	ab.mode = modeInput
+	ab.message = fmt.Sprintf("copied %s %s into the editor", e.Method, e.Target)
+	ab.setFocus(focusRequestLine)
+	ab.draw()
+}
@@ -1,76 +1,246 @@
 package main
 
 import (
-	"bufio"
-	"errors"
+	"encoding/base64"
 	"fmt"
-	"os"
-	"regexp"
+	"net"
+	"net/url"
+	"strconv"
 	"strings"
 )
 
-// targetとportをstdInから受け付ける。
-func recvTargetInfo() (string, string) {
+// schemeごとのデフォルトのポート番号。
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// 接続先を表すURL。scheme://[userinfo@]host[:port][/path][?query][#fragment]
+type URL struct {
+	Scheme   string // 小文字にしたもの
+	Username string // デコードしたもの
+	Password string // デコードしたもの
+	Host     string // IPv6アドレスは[]を外したもの
+	Port     string // 省略されていればschemeのデフォルト
+	Path     string // 省略されていれば"/"
+	RawQuery string
+	Fragment string
+}
+
+// URLのどの部分が正しくないかを示すエラー。
+type URLError struct {
+	Component string // "scheme", "userinfo", "host", "port", "path", "query", "fragment"
+	Value     string
+	Reason    string
+}
+
+func (e *URLError) Error() string {
+	return fmt.Sprintf("invalid %s %q: %s", e.Component, e.Value, e.Reason)
+}
+
+// sをURLとして解析する。
+func ParseURL(s string) (*URL, error) {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c <= ' ' || c >= 0x7f {
+			return nil, &URLError{"url", s, fmt.Sprintf("invalid character %q at offset %d", c, i)}
+		}
+	}
+
+	u := &URL{}
+
+	scheme, rest, ok := strings.Cut(s, "://")
+	if !ok {
+		return nil, &URLError{"scheme", s, "missing scheme (e.g. http://)"}
+	}
+	if !isScheme(scheme) {
+		return nil, &URLError{"scheme", scheme, "must begin with a letter followed by letters, digits, '+', '-' or '.'"}
+	}
+	u.Scheme = strings.ToLower(scheme)
+	defaultPort, ok := defaultPorts[u.Scheme]
+	if !ok {
+		return nil, &URLError{"scheme", scheme, "unsupported scheme (supported: http, https)"}
+	}
 
-	fmt.Println("waiting for your input(e.g. hostname port)...")
-	scanner := bufio.NewScanner(os.Stdin)
-	scanner.Scan()
+	rest, u.Fragment, _ = strings.Cut(rest, "#")
+	rest, u.RawQuery, _ = strings.Cut(rest, "?")
+	authority, path := rest, "/"
+	if i := strings.Index(rest, "/"); i >= 0 {
+		authority, path = rest[:i], rest[i:]
+	}
 
-	target, port, b := strings.Cut(scanner.Text(), " ")
-	if !b {
-		// test my-tcp-server
-		// target = "127.0.0.1"
-		// port = "8080"
+	if i := strings.LastIndex(authority, "@"); i >= 0 {
+		if err := u.parseUserinfo(authority[:i]); err != nil {
+			return nil, err
+		}
+		authority = authority[i+1:]
+	}
 
-		// test google
-		target = "www.google.com"
-		port = "80"
+	var err error
+	if u.Host, u.Port, err = parseHostPort(authority, defaultPort); err != nil {
+		return nil, err
 	}
 
-	fmt.Printf("%s:%s\n", target, port)
-	fmt.Printf("address: target=%s, port=%s \n", target, port)
+	if err := checkURLChars("path", path, "/"); err != nil {
+		return nil, err
+	}
+	if err := checkURLChars("query", u.RawQuery, "/?"); err != nil {
+		return nil, err
+	}
+	if err := checkURLChars("fragment", u.Fragment, "/?"); err != nil {
+		return nil, err
+	}
+	u.Path = path
 
-	return target, port
+	return u, nil
 }
 
-// ターゲットとポート番号のバリデーションのエントリ。
-func validateInputArgs(target, port string) error {
-	// hostname, ip-address, port
-	if err := validateTargetInfo(target, port); err != nil {
+// "user[:password]"を解析する。
+func (u *URL) parseUserinfo(userinfo string) error {
+	if err := checkURLChars("userinfo", userinfo, ""); err != nil {
 		return err
 	}
+	user, password, _ := strings.Cut(userinfo, ":")
 
+	var err error
+	if u.Username, err = url.PathUnescape(user); err != nil {
+		return &URLError{"userinfo", userinfo, err.Error()}
+	}
+	if u.Password, err = url.PathUnescape(password); err != nil {
+		return &URLError{"userinfo", userinfo, err.Error()}
+	}
 	return nil
 }
 
-// ターゲットとポート番号のバリデーション。
-func validateTargetInfo(target, port string) error {
-	// hostname
-	if r, err := validate(matchHostNameString, target, inEligibleTarget); !r {
-		// ip-address
-		r, err = validate(matchIPAddressString, target, inEligibleTarget)
-		if err != nil {
-			return err
+// リクエストで送るpathとquery。
+func (u *URL) RequestURI() string {
+	if u.RawQuery == "" {
+		return u.Path
+	}
+	return u.Path + "?" + u.RawQuery
+}
+
+// userinfoがあれば、Basic認証のAuthorizationヘッダーの値を返す。
+func (u *URL) basicAuth() string {
+	if u.Username == "" && u.Password == "" {
+		return ""
+	}
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(u.Username+":"+u.Password))
+}
+
+// "host[:port]"を解析する。IPv6アドレスは"[::1]:8080"のように[]で囲む。
+// portが省略されていればdefaultPortにする。portはサービス名で書いてもよく、番号にして返す。
+func parseHostPort(hostport, defaultPort string) (host, port string, err error) {
+	port = defaultPort
+
+	if strings.HasPrefix(hostport, "[") {
+		end := strings.Index(hostport, "]")
+		if end < 0 {
+			return "", "", &URLError{"host", hostport, "missing ']' after IPv6 address"}
+		}
+		host = hostport[1:end]
+		if ip := net.ParseIP(host); ip == nil || !strings.Contains(host, ":") {
+			return "", "", &URLError{"host", host, "not a valid IPv6 address"}
+		}
+
+		rest := hostport[end+1:]
+		if rest != "" && !strings.HasPrefix(rest, ":") {
+			return "", "", &URLError{"host", hostport, "unexpected characters after ']'"}
+		}
+		if p := strings.TrimPrefix(rest, ":"); p != "" {
+			port = p
+		}
+	} else {
+		h, p, hasPort := strings.Cut(hostport, ":")
+		if strings.Contains(p, ":") {
+			return "", "", &URLError{"host", hostport, "IPv6 address must be enclosed in '[' and ']'"}
+		}
+		host = h
+		if hasPort && p != "" {
+			port = p
+		}
+		if err := checkHostName(host); err != nil {
+			return "", "", err
 		}
-	} else if err != nil {
-		return err
 	}
 
-	// port
-	if _, err := validate(matchPortString, port, inEligiblePortNumber); err != nil {
-		return err
+	n, err := resolvePort(port)
+	if err != nil {
+		return "", "", err
+	}
+	return host, strconv.Itoa(n), nil
+}
+
+// hostがIPv4アドレスか、ラベルを"."でつないだホスト名であるか確かめる。
+// docker composeのサービス名(e.g. my_service)に接続できるように、ラベルには'_'も許す。
+func checkHostName(host string) error {
+	if host == "" {
+		return &URLError{"host", host, "missing host"}
+	}
+
+	if strings.Trim(host, "0123456789.") == "" {
+		if ip := net.ParseIP(host); ip == nil || ip.To4() == nil {
+			return &URLError{"host", host, "not a valid IPv4 address"}
+		}
+		return nil
 	}
 
+	name := strings.TrimSuffix(host, ".")
+	if len(name) > 253 {
+		return &URLError{"host", host, "longer than 253 characters"}
+	}
+	for _, label := range strings.Split(name, ".") {
+		switch {
+		case label == "":
+			return &URLError{"host", host, "empty label"}
+		case len(label) > 63:
+			return &URLError{"host", host, fmt.Sprintf("label %q is longer than 63 characters", label)}
+		case label[0] == '-' || label[len(label)-1] == '-':
+			return &URLError{"host", host, fmt.Sprintf("label %q begins or ends with '-'", label)}
+		}
+		for i := 0; i < len(label); i++ {
+			if c := label[i]; !isAlnum(c) && c != '-' && c != '_' {
+				return &URLError{"host", host, fmt.Sprintf("invalid character %q", c)}
+			}
+		}
+	}
 	return nil
+}
 
+// sがunreserved, sub-delims, ':', '@'とextraの文字、"%XX"の形のエスケープだけでできているか確かめる。
+func checkURLChars(component, s, extra string) error {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '%':
+			if i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+				return &URLError{component, s, fmt.Sprintf("invalid escape at offset %d", i)}
+			}
+			i += 2
+		case isAlnum(c), strings.IndexByte("-._~!$&'()*+,;=:@", c) >= 0, strings.IndexByte(extra, c) >= 0:
+		default:
+			return &URLError{component, s, fmt.Sprintf("invalid character %q", c)}
+		}
+	}
+	return nil
 }
-func validate(m string, c string, e string) (bool, error) {
-	r, err := regexp.MatchString(m, c)
-	if !r {
-		return r, errors.New(e)
-	} else if err != nil {
-		return r, err
+
+// scheme = ALPHA *( ALPHA / DIGIT / "+" / "-" / "." )
+func isScheme(s string) bool {
+	if s == "" || !isAlnum(s[0]) || '0' <= s[0] && s[0] <= '9' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; !isAlnum(c) && c != '+' && c != '-' && c != '.' {
+			return false
+		}
 	}
+	return true
+}
+
+func isAlnum(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
 
-	return r, nil
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
 }
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+)
+
+type KeyCode int
+
+const (
+	KeyRune KeyCode = iota
+	KeyEnter
+	KeyTab
+	KeyBackspace
+	KeyEsc
+	KeyUp
+	KeyDown
+	KeyRight
+	KeyLeft
+	KeyHome
+	KeyEnd
+	KeyPgUp
+	KeyPgDn
+	KeyBacktab // Shift-Tab
+	KeyInsert
+	KeyDelete
+	KeyF1
+	KeyF2
+	KeyF3
+	KeyF4
+	KeyF5
+	KeyF6
+	KeyF7
+	KeyF8
+	KeyF9
+	KeyF10
+	KeyF11
+	KeyF12
+	KeyPaste
+	KeyUnknown
+)
+
+const (
+	EnableBracketedPaste  = "\x1b[?2004h"
+	DisableBracketedPaste = "\x1b[?2004l"
+
+	pasteEnd = "\x1b[201~"
+)
+
+// 1回のキー入力。KeyRuneのときはRuneに入力された文字が、
+// KeyPasteのときはTextに貼り付けられたテキストが入る。
+type Key struct {
+	Code KeyCode
+	Rune rune
+	Text string
+}
+
+// 端末から1キー分を読みとる。矢印キーなどのエスケープシーケンスは1つのKeyにまとめる。
+func (rw TerminalReadWriter) ReadKey() (Key, error) {
+	b, err := rw.ReadByte()
+	if err != nil {
+		return Key{}, err
+	}
+
+	switch b {
+	case 0x1b:
+		// ESCの直後に続きが届いていなければ、ESCキーそのものとみなす。
+		if rw.Buffered() == 0 {
+			return Key{Code: KeyEsc}, nil
+		}
+		return rw.readEscapeSequence()
+	case Enter, '\n':
+		return Key{Code: KeyEnter}, nil
+	case Tab:
+		return Key{Code: KeyTab}, nil
+	case Backspace, CtrlH:
+		return Key{Code: KeyBackspace}, nil
+	}
+
+	if b < utf8.RuneSelf {
+		return Key{Code: KeyRune, Rune: rune(b)}, nil
+	}
+
+	if err := rw.UnreadByte(); err != nil {
+		return Key{}, err
+	}
+	r, _, err := rw.ReadRune()
+	if err != nil {
+		return Key{}, err
+	}
+	return Key{Code: KeyRune, Rune: r}, nil
+}
+
+// ESCに続くCSI(ESC [)とSS3(ESC O)のシーケンスを読む。
+func (rw TerminalReadWriter) readEscapeSequence() (Key, error) {
+	b, err := rw.ReadByte()
+	if err != nil {
+		return Key{}, err
+	}
+
+	switch b {
+	case '[':
+		// パラメータ(0x30-0x3F)、中間(0x20-0x2F)、終端(0x40-0x7E)の順に並ぶ。
+		var params []byte
+		for {
+			c, err := rw.ReadByte()
+			if err != nil {
+				return Key{}, err
+			}
+			if 0x40 <= c && c <= 0x7e {
+				if string(params) == "200" && c == '~' {
+					return rw.readPaste()
+				}
+				if len(params) == 0 && c == '[' {
+					// LinuxコンソールのF1-F5はESC [ [ A-Eになる。
+					c, err := rw.ReadByte()
+					if err != nil {
+						return Key{}, err
+					}
+					if 'A' <= c && c <= 'E' {
+						return Key{Code: KeyF1 + KeyCode(c-'A')}, nil
+					}
+					return Key{Code: KeyUnknown}, nil
+				}
+				return csiKey(string(params), c), nil
+			}
+			params = append(params, c)
+		}
+	case 'O':
+		c, err := rw.ReadByte()
+		if err != nil {
+			return Key{}, err
+		}
+		return csiKey("", c), nil
+	}
+
+	return Key{Code: KeyUnknown}, nil
+}
+
+// bracketed pasteで貼り付けられたテキストをESC [201~まで読む。
+// 1文字ずつのキー入力として扱うと、改行やタブで入力欄が移ってしまうのでまとめて返す。
+func (rw TerminalReadWriter) readPaste() (Key, error) {
+	var text []byte
+	for {
+		c, err := rw.ReadByte()
+		if err != nil {
+			return Key{}, err
+		}
+		text = append(text, c)
+
+		if bytes.HasSuffix(text, []byte(pasteEnd)) {
+			return Key{Code: KeyPaste, Text: string(bytes.TrimSuffix(text, []byte(pasteEnd)))}, nil
+		}
+	}
+}
+
+// ESC [ n ~ で送られるファンクションキーの番号。
+var functionKeys = map[string]KeyCode{
+	"11": KeyF1, "12": KeyF2, "13": KeyF3, "14": KeyF4, "15": KeyF5,
+	"17": KeyF6, "18": KeyF7, "19": KeyF8, "20": KeyF9, "21": KeyF10,
+	"23": KeyF11, "24": KeyF12,
+}
+
+// CSIとSS3のシーケンスをKeyにする。Shift-矢印のような修飾キーの指定(";2"など)は無視する。
+func csiKey(params string, final byte) Key {
+	params, _, _ = strings.Cut(params, ";")
+
+	switch final {
+	case 'A':
+		return Key{Code: KeyUp}
+	case 'B':
+		return Key{Code: KeyDown}
+	case 'C':
+		return Key{Code: KeyRight}
+	case 'D':
+		return Key{Code: KeyLeft}
+	case 'H':
+		return Key{Code: KeyHome}
+	case 'F':
+		return Key{Code: KeyEnd}
+	case 'Z':
+		return Key{Code: KeyBacktab}
+	case 'P', 'Q', 'R', 'S':
+		return Key{Code: KeyF1 + KeyCode(final-'P')}
+	case '~':
+		switch params {
+		case "1", "7":
+			return Key{Code: KeyHome}
+		case "2":
+			return Key{Code: KeyInsert}
+		case "3":
+			return Key{Code: KeyDelete}
+		case "4", "8":
+			return Key{Code: KeyEnd}
+		case "5":
+			return Key{Code: KeyPgUp}
+		case "6":
+			return Key{Code: KeyPgDn}
+		}
+		if code, ok := functionKeys[params]; ok {
+			return Key{Code: code}
+		}
+	}
+
+	return Key{Code: KeyUnknown}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// 端末上の矩形の領域。Row, Colは1始まり。
+type Rect struct {
+	Row, Col, Width, Height int
+}
+
+// 枠線の内側の領域。
+func (r Rect) Inner() Rect {
+	return Rect{r.Row + 1, r.Col + 1, r.Width - 2, r.Height - 2}
+}
+
+// 横に並べて分割する。Widthをweightsの比で分け、余りは最後の領域に足す。
+func (r Rect) SplitColumns(weights ...int) []Rect {
+	sizes := splitSize(r.Width, weights)
+	rects := make([]Rect, len(sizes))
+	col := r.Col
+	for i, w := range sizes {
+		rects[i] = Rect{r.Row, col, w, r.Height}
+		col += w
+	}
+	return rects
+}
+
+// 縦に並べて分割する。Heightをweightsの比で分け、余りは最後の領域に足す。
+func (r Rect) SplitRows(weights ...int) []Rect {
+	sizes := splitSize(r.Height, weights)
+	rects := make([]Rect, len(sizes))
+	row := r.Row
+	for i, h := range sizes {
+		rects[i] = Rect{row, r.Col, r.Width, h}
+		row += h
+	}
+	return rects
+}
+
+func splitSize(total int, weights []int) []int {
+	sum := 0
+	for _, w := range weights {
+		sum += w
+	}
+
+	sizes := make([]int, len(weights))
+	rest := total
+	for i, w := range weights {
+		sizes[i] = total * w / sum
+		rest -= sizes[i]
+	}
+	sizes[len(sizes)-1] += rest
+
+	// 足りる限り、どの領域にも1つは割り当てる。
+	for i := range sizes {
+		if sizes[i] > 0 {
+			continue
+		}
+		j := slices.Index(sizes, slices.Max(sizes))
+		if sizes[j] > 1 {
+			sizes[j]--
+			sizes[i]++
+		}
+	}
+	return sizes
+}
+
+// 枠で囲まれた領域。Sectionsは上から順に並び、タイトル付きの区切り線で分けられる。
+type Panel struct {
+	Title    string
+	Rect     Rect
+	Sections []*Section
+}
+
+type Section struct {
+	Title  string
+	Rows   int  // 0なら残りの行をWeightの比で分け合う
+	Weight int  // 0なら1とみなす
+	Rect   Rect // Panel.layoutで計算される中身の領域
+}
+
+func NewPanel(title string, r Rect, sections ...*Section) *Panel {
+	p := &Panel{Title: title, Rect: r, Sections: sections}
+	p.layout()
+	return p
+}
+
+// 枠線と区切り線を除いた行数を、各Sectionに割り当てる。
+func (p *Panel) layout() {
+	fixed := 0
+	var weights []int
+	for i, s := range p.Sections {
+		if i > 0 || s.Title != "" {
+			fixed++ // 区切り線
+		}
+		if s.Rows == 0 {
+			weights = append(weights, max(s.Weight, 1))
+		}
+		fixed += s.Rows
+	}
+
+	var flexible []int
+	if len(weights) > 0 {
+		flexible = splitSize(max(0, p.Rect.Height-2-fixed), weights)
+	}
+
+	row := p.Rect.Row + 1
+	for i, s := range p.Sections {
+		if i > 0 || s.Title != "" {
+			row++
+		}
+
+		rows := s.Rows
+		if rows == 0 {
+			rows = flexible[0]
+			flexible = flexible[1:]
+		}
+		s.Rect = Rect{row, p.Rect.Col + 1, p.Rect.Width - 2, rows}
+		row += rows
+	}
+}
+
+// Panelに必要な最小の高さ。伸縮するSectionには1行ずつ割り当てる。
+func (p *Panel) MinHeight() int {
+	h := 2
+	for i, s := range p.Sections {
+		if i > 0 || s.Title != "" {
+			h++
+		}
+		h += max(s.Rows, 1)
+	}
+	return h
+}
+
+// 枠線と区切り線を描画する文字列を作る。中身は空白で埋める。
+func (p *Panel) Draw() string {
+	r := p.Rect
+	var b strings.Builder
+
+	b.WriteString(moveTo(r.Row, r.Col) + borderLine("┏", "━", "┓", p.Title, r.Width))
+	for i, s := range p.Sections {
+		if i > 0 || s.Title != "" {
+			b.WriteString(moveTo(s.Rect.Row-1, r.Col) + borderLine("┣", "━", "┫", s.Title, r.Width))
+		}
+		for row := s.Rect.Row; row < s.Rect.Row+s.Rect.Height; row++ {
+			b.WriteString(moveTo(row, r.Col) + "┃" + strings.Repeat(" ", r.Width-2) + "┃")
+		}
+	}
+	b.WriteString(moveTo(r.Row+r.Height-1, r.Col) + borderLine("┗", "━", "┛", "", r.Width))
+
+	return b.String()
+}
+
+// linesをrectの左上から1行ずつ描画する文字列を作る。
+func drawLines(r Rect, lines []string) string {
+	var b strings.Builder
+	for i, l := range lines {
+		if i >= r.Height {
+			break
+		}
+		b.WriteString(moveTo(r.Row+i, r.Col) + l)
+	}
+	return b.String()
+}
+
+// rectを空白で消してから、linesを1行ずつ描画する文字列を作る。
+// 入力欄のように、前に描画した内容を上書きするときに使う。
+func fillLines(r Rect, lines []string) string {
+	var b strings.Builder
+	blank := strings.Repeat(" ", r.Width)
+	for i := 0; i < r.Height; i++ {
+		b.WriteString(moveTo(r.Row+i, r.Col) + blank)
+		if i < len(lines) {
+			b.WriteString(moveTo(r.Row+i, r.Col) + lines[i])
+		}
+	}
+	return b.String()
+}
+
+// カーソルを移動するエスケープシーケンス。
+func moveTo(row, col int) string {
+	return fmt.Sprintf("\x1b[%d;%dH", row, col)
+}
+
+// titleを中央に置いた枠線の行を作る。
+func borderLine(left, fill, right, title string, width int) string {
+	if title != "" {
+		title = " " + title + " "
+	}
+
+	w := width - 2 - utf8.RuneCountInString(title)
+	if w < 0 {
+		title = ""
+		w = width - 2
+	}
+	return left + strings.Repeat(fill, w/2) + title + strings.Repeat(fill, w-w/2) + right
+}
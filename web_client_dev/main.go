@@ -1,20 +1,23 @@
 package main
 
+import (
+	"fmt"
+	"os"
+)
+
+// 引数があればリクエストを1つ送って終了し、なければ対話的な画面を開く。
 func main() {
-	// t, p := recvTargetInfo()
-	// client := NewHTTPClient(t, p)
-	//
-	// resp, err := client.getHTTPResponse()
-	// if err != nil {
-	// 	fmt.Println(err)
-	// 	os.Exit(1)
-	// }
-	//
-	// resp.Status()
-	// fmt.Println(resp.Status(), "\n#########")
-	// fmt.Println(resp.Header(), "\n#########")
-	// fmt.Println(resp.Body(), "\n#########")
+	if len(os.Args) > 1 {
+		os.Exit(runCLI(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+	}
 
-	myTerminal := NewAlternateBuffer()
-	myTerminal.Enter()
+	myTerminal, err := NewAlternateBuffer()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "client: %v\n", err)
+		os.Exit(1)
+	}
+	if err := myTerminal.Enter(); err != nil {
+		fmt.Fprintf(os.Stderr, "client: %v\n", err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// 接続を使い回すときの上限。0なら上限を設けない。
+type PoolConfig struct {
+	MaxIdle        int           // 全ての接続先で待たせておく接続の数
+	MaxIdlePerHost int           // 接続先ごとに待たせておく接続の数
+	MaxPerHost     int           // 接続先ごとの使用中の接続の数。超えるとどれかが空くかctxが終わるまで待つ
+	IdleTimeout    time.Duration // これより長く使われなかった接続は閉じる
+}
+
+var DefaultPoolConfig = PoolConfig{
+	MaxIdle:        64,
+	MaxIdlePerHost: 4,
+	MaxPerHost:     0,
+	IdleTimeout:    90 * time.Second,
+}
+
+// 接続先(host:port)ごとに、レスポンスを読み終えた接続を待たせておき次のリクエストで使い回す。
+type ConnPool struct {
+	cfg PoolConfig
+
+	mu    sync.Mutex
+	idle  map[string][]*persistConn // 接続先ごとに、古いものから並べる
+	slots map[string]chan struct{}  // 接続先ごとに、使用中の接続の数だけ値が入っている。MaxPerHostが0なら使わない
+	nidle int
+}
+
+// プールから取り出した接続。
+type persistConn struct {
+	net.Conn
+	address string
+	reused  bool // 前のリクエストで使った接続
+	idleAt  time.Time
+
+	mu       sync.Mutex
+	canceled bool // キャンセルされた。読み書きの期限を過去にしてある
+}
+
+func NewConnPool(cfg PoolConfig) *ConnPool {
+	return &ConnPool{
+		cfg:   cfg,
+		idle:  map[string][]*persistConn{},
+		slots: map[string]chan struct{}{},
+	}
+}
+
+// addressへの接続を取り出す。待たせている接続がなければdialで新しく接続する。
+// MaxPerHostまで使われていれば空くまで待ち、その間にctxが終わればctxのエラーを返す。
+func (p *ConnPool) get(ctx context.Context, address string, dial func() (net.Conn, error)) (*persistConn, error) {
+	if sem := p.sem(address); sem != nil {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	p.mu.Lock()
+	pc := p.popIdle(address)
+	p.mu.Unlock()
+	if pc != nil {
+		return pc, nil
+	}
+
+	conn, err := dial()
+	if err != nil {
+		p.release(address)
+		return nil, err
+	}
+	return &persistConn{Conn: conn, address: address}, nil
+}
+
+// addressの待たせている接続のうち、一番新しく使えるものを取り出す。古くなったものや閉じられたものは閉じる。
+func (p *ConnPool) popIdle(address string) *persistConn {
+	for conns := p.idle[address]; len(conns) > 0; conns = p.idle[address] {
+		pc := conns[len(conns)-1]
+		p.idle[address] = conns[:len(conns)-1]
+		p.nidle--
+
+		if p.cfg.IdleTimeout > 0 && time.Since(pc.idleAt) > p.cfg.IdleTimeout || !pc.alive() {
+			pc.Close()
+			continue
+		}
+		pc.reused = true
+		pc.canceled = false
+		return pc
+	}
+	return nil
+}
+
+// 使い終えた接続を待たせておく。上限を超えるなら一番古い接続を閉じる。
+func (p *ConnPool) put(pc *persistConn) {
+	defer p.release(pc.address)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pc.idleAt = time.Now()
+	p.idle[pc.address] = append(p.idle[pc.address], pc)
+	p.nidle++
+
+	if p.cfg.MaxIdlePerHost > 0 && len(p.idle[pc.address]) > p.cfg.MaxIdlePerHost {
+		p.closeOldest(pc.address)
+	}
+	if p.cfg.MaxIdle > 0 && p.nidle > p.cfg.MaxIdle {
+		oldest := ""
+		for address, conns := range p.idle {
+			if len(conns) > 0 && (oldest == "" || conns[0].idleAt.Before(p.idle[oldest][0].idleAt)) {
+				oldest = address
+			}
+		}
+		p.closeOldest(oldest)
+	}
+}
+
+func (p *ConnPool) closeOldest(address string) {
+	conns := p.idle[address]
+	conns[0].Close()
+	p.idle[address] = slices.Delete(conns, 0, 1)
+	p.nidle--
+}
+
+// 使い回せない接続を閉じる。
+func (p *ConnPool) discard(pc *persistConn) {
+	pc.Close()
+	p.release(pc.address)
+}
+
+// addressの使用中の接続を1つ減らし、待っているgetがあれば進める。
+func (p *ConnPool) release(address string) {
+	if sem := p.sem(address); sem != nil {
+		<-sem
+	}
+}
+
+// addressの使用中の接続を数えるチャネル。MaxPerHostが0ならnilを返す。
+func (p *ConnPool) sem(address string) chan struct{} {
+	if p.cfg.MaxPerHost <= 0 {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sem, ok := p.slots[address]
+	if !ok {
+		sem = make(chan struct{}, p.cfg.MaxPerHost)
+		p.slots[address] = sem
+	}
+	return sem
+}
+
+// 待たせている接続を全て閉じる。
+func (p *ConnPool) CloseIdle() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for address, conns := range p.idle {
+		for _, pc := range conns {
+			pc.Close()
+		}
+		delete(p.idle, address)
+	}
+	p.nidle = 0
+}
+
+// 読み込みの期限を設定する。キャンセルされていれば、すぐに失敗するように過去の時刻にする。
+func (pc *persistConn) setReadDeadline(t time.Time) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.canceled {
+		t = aLongTimeAgo
+	}
+	pc.SetReadDeadline(t)
+}
+
+// 書き込みの期限を設定する。キャンセルされていれば、すぐに失敗するように過去の時刻にする。
+func (pc *persistConn) setWriteDeadline(t time.Time) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.canceled {
+		t = aLongTimeAgo
+	}
+	pc.SetWriteDeadline(t)
+}
+
+// 読み書きしている途中でもすぐに失敗させる。
+func (pc *persistConn) cancel() {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.canceled = true
+	pc.SetDeadline(aLongTimeAgo)
+}
+
+// 相手が接続を閉じていないか確かめる。待っている間に何か届いていれば、それも使えない接続とみなす。
+func (pc *persistConn) alive() bool {
+	pc.SetReadDeadline(time.Now())
+	defer pc.SetReadDeadline(time.Time{})
+
+	var b [1]byte
+	n, err := pc.Read(b[:])
+	var ne net.Error
+	return n == 0 && errors.As(err, &ne) && ne.Timeout()
+}
+
+// 使い回した接続で送ったリクエストが、相手に閉じられていたために失敗したとみられるか。
+func isStaleConnError(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
+
+// 送り直しても結果が変わらないメソッド(RFC 9110 9.2.2)。
+func isIdempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
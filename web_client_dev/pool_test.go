@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func pipeDial() (net.Conn, error) {
+	c, _ := net.Pipe()
+	return c, nil
+}
+
+func TestConnPoolWaitForSlot(t *testing.T) {
+	tests := []struct {
+		name    string
+		release func(p *ConnPool, pc *persistConn)
+	}{
+		{"discard frees the slot", (*ConnPool).discard},
+		{"put frees the slot", (*ConnPool).put},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewConnPool(PoolConfig{MaxPerHost: 1})
+			pc, err := p.get(context.Background(), "a:80", pipeDial)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// 空きがないまま期限が来たら、待つのをやめる。
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			start := time.Now()
+			if _, err := p.get(ctx, "a:80", pipeDial); !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("err = %v, want %v", err, context.DeadlineExceeded)
+			}
+			if d := time.Since(start); d > time.Second {
+				t.Fatalf("get returned after %v", d)
+			}
+
+			// 別の接続先は待たない。
+			other, err := p.get(context.Background(), "b:80", pipeDial)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p.discard(other)
+
+			// 待っている間に空けば取り出せる。
+			done := make(chan error, 1)
+			go func() {
+				pc, err := p.get(context.Background(), "a:80", pipeDial)
+				if err == nil {
+					p.discard(pc)
+				}
+				done <- err
+			}()
+			time.Sleep(10 * time.Millisecond)
+			tt.release(p, pc)
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Fatal(err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("get did not return after the slot was freed")
+			}
+		})
+	}
+}
+
+func TestConnPoolCancelWait(t *testing.T) {
+	p := NewConnPool(PoolConfig{MaxPerHost: 1})
+	if _, err := p.get(context.Background(), "a:80", pipeDial); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.get(ctx, "a:80", pipeDial)
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("err = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("get did not return after cancel")
+	}
+}
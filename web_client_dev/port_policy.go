@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ポート番号の代わりに書けるサービス名。
+var servicePorts = map[string]int{
+	"http":  80,
+	"https": 443,
+}
+
+// portを1から65535のポート番号にする。"http"のようなサービス名も受け付ける。
+func resolvePort(port string) (int, error) {
+	if n, ok := servicePorts[strings.ToLower(port)]; ok {
+		return n, nil
+	}
+	if port == "" || strings.Trim(port, "0123456789") != "" {
+		return 0, &URLError{"port", port, "must be a number or a service name (http, https)"}
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return 0, &URLError{"port", port, "out of range 1-65535"}
+	}
+	return n, nil
+}
+
+// 接続してよいポートの決まり。Denyに当てはまるポートと、Allowがあればそれに当てはまらないポートには接続しない。
+// 要素は"8080"のようなポート番号か"8000-8999"のような範囲、またはサービス名で書く。
+type PortPolicy struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+
+	allow, deny []portRange
+	path        string
+}
+
+type portRange struct {
+	lo, hi int
+}
+
+// ポートの決まりのファイルの場所。
+func defaultPortPolicyPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "web_client", "ports.json"), nil
+}
+
+// pathからポートの決まりを読む。ファイルがなければnilを返し、どのポートにも接続できるようにする。
+func LoadPortPolicy(path string) (*PortPolicy, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p := &PortPolicy{path: path}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if p.allow, err = parsePortRanges(p.Allow); err != nil {
+		return nil, fmt.Errorf("%s: allow: %w", path, err)
+	}
+	if p.deny, err = parsePortRanges(p.Deny); err != nil {
+		return nil, fmt.Errorf("%s: deny: %w", path, err)
+	}
+	return p, nil
+}
+
+func parsePortRanges(specs []string) ([]portRange, error) {
+	var ranges []portRange
+	for _, spec := range specs {
+		lo, hi, isRange := strings.Cut(strings.TrimSpace(spec), "-")
+		if !isRange {
+			hi = lo
+		}
+
+		l, err := resolvePort(strings.TrimSpace(lo))
+		if err != nil {
+			return nil, err
+		}
+		h, err := resolvePort(strings.TrimSpace(hi))
+		if err != nil {
+			return nil, err
+		}
+		if l > h {
+			return nil, fmt.Errorf("invalid port range %q", spec)
+		}
+		ranges = append(ranges, portRange{l, h})
+	}
+	return ranges, nil
+}
+
+func inPortRanges(ranges []portRange, port int) bool {
+	for _, r := range ranges {
+		if r.lo <= port && port <= r.hi {
+			return true
+		}
+	}
+	return false
+}
+
+// portに接続してよいか確かめる。nilのPortPolicyはどのポートも許す。
+func (p *PortPolicy) Check(port string) error {
+	if p == nil {
+		return nil
+	}
+	n, err := resolvePort(port)
+	if err != nil {
+		return err
+	}
+	if inPortRanges(p.deny, n) {
+		return fmt.Errorf("port %d is denied by %s", n, p.path)
+	}
+	if len(p.allow) > 0 && !inPortRanges(p.allow, n) {
+		return fmt.Errorf("port %d is not allowed by %s (allowed: %s)", n, p.path, strings.Join(p.Allow, ", "))
+	}
+	return nil
+}
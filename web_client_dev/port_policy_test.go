@@ -0,0 +1,141 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolvePort(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+		ok   bool
+	}{
+		{"1", 1, true},
+		{"80", 80, true},
+		{"65535", 65535, true},
+		{"http", 80, true},
+		{"HTTPS", 443, true},
+		{"", 0, false},
+		{"0", 0, false},
+		{"65536", 0, false},
+		{"99999999999999999999", 0, false},
+		{"-1", 0, false},
+		{"+80", 0, false},
+		{" 80", 0, false},
+		{"ssh", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := resolvePort(tt.in)
+			if (err == nil) != tt.ok || got != tt.want {
+				t.Errorf("resolvePort = %d, %v, want %d (ok %v)", got, err, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestPortPolicyCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		allowed []string
+		denied  []string
+	}{
+		{
+			name:    "empty",
+			json:    `{}`,
+			allowed: []string{"1", "80", "8080", "65535"},
+		},
+		{
+			name:    "allow ranges",
+			json:    `{"allow": ["80", "8000-8999", "https"]}`,
+			allowed: []string{"80", "http", "443", "8000", "8500", "8999"},
+			denied:  []string{"81", "7999", "9000", "22"},
+		},
+		{
+			name:    "deny ranges",
+			json:    `{"deny": ["1-1023", "8081"]}`,
+			allowed: []string{"1024", "8080", "8082", "65535"},
+			denied:  []string{"1", "22", "http", "1023", "8081"},
+		},
+		{
+			name:    "deny wins over allow",
+			json:    `{"allow": [" 8000 - 8999 "], "deny": ["8081"]}`,
+			allowed: []string{"8000", "8080", "8082"},
+			denied:  []string{"8081", "80"},
+		},
+		{
+			name:    "single port range",
+			json:    `{"allow": ["8080-8080"]}`,
+			allowed: []string{"8080"},
+			denied:  []string{"8079", "8081"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadTestPortPolicy(t, tt.json)
+			for _, port := range tt.allowed {
+				if err := p.Check(port); err != nil {
+					t.Errorf("Check(%s) = %v, want allowed", port, err)
+				}
+			}
+			for _, port := range tt.denied {
+				if err := p.Check(port); err == nil {
+					t.Errorf("Check(%s) = nil, want denied", port)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadPortPolicyError(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+	}{
+		{"not JSON", `allow: 80`},
+		{"reversed range", `{"allow": ["9000-8000"]}`},
+		{"out of range", `{"deny": ["0-100"]}`},
+		{"open range", `{"allow": ["8000-"]}`},
+		{"unknown service", `{"allow": ["gopher"]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "ports.json")
+			if err := os.WriteFile(path, []byte(tt.json), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadPortPolicy(path); err == nil {
+				t.Errorf("LoadPortPolicy succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestLoadPortPolicyMissing(t *testing.T) {
+	p, err := LoadPortPolicy(filepath.Join(t.TempDir(), "ports.json"))
+	if p != nil || err != nil {
+		t.Fatalf("LoadPortPolicy = %v, %v, want nil, nil", p, err)
+	}
+	if err := p.Check("8080"); err != nil {
+		t.Errorf("nil policy denied 8080: %v", err)
+	}
+}
+
+func loadTestPortPolicy(t *testing.T, json string) *PortPolicy {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ports.json")
+	if err := os.WriteFile(path, []byte(json), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadPortPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadPortPolicy: %v", err)
+	}
+	return p
+}
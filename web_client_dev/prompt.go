@@ -0,0 +1,38 @@
+package main
+
+import "fmt"
+
+// 操作説明の行に出す、1行の入力欄。Enterで確定し、ESCで取り消す。
+type prompt struct {
+	label  string
+	editor *LineEditor
+	done   func(answer string)
+}
+
+// labelを出して入力を受け付け、確定したらdoneを呼ぶ。
+func (ab *AlternateBuffer) ask(label, initial string, done func(answer string)) {
+	ab.prompt = &prompt{label: label, editor: NewLineEditor(initial), done: done}
+}
+
+// 入力中のpromptにキー入力を渡す。
+func (ab *AlternateBuffer) handlePromptKey(k Key) {
+	p := ab.prompt
+	switch k.Code {
+	case KeyEnter:
+		ab.prompt = nil
+		p.done(p.editor.String())
+	case KeyEsc:
+		ab.prompt = nil
+	default:
+		p.editor.HandleKey(k)
+	}
+}
+
+// promptを操作説明の行に描画し、カーソルを置く位置を返す。
+func (ab *AlternateBuffer) drawPrompt() (row, col int) {
+	r := ab.layout.help
+	label := fitWidth(ab.prompt.label, r.Width/2)
+	text, cursorCol := ab.prompt.editor.view(r.Width - stringWidth(label))
+	fmt.Print(fillLines(r, []string{label + text}))
+	return r.Row, r.Col + stringWidth(label) + cursorCol
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var httpMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
+
+// HTTPClientで送るリクエスト。
+type Request struct {
+	Method string
+	Target string // pathとquery(e.g. /search?q=go)
+	Header Header
+	Body   []byte
+}
+
+// method, target(pathとquery), bodyからリクエストを作る。targetが空なら"/"にする。
+func NewRequest(method, target string, body []byte) (*Request, error) {
+	req := &Request{
+		Method: strings.ToUpper(method),
+		Target: target,
+		Header: Header{},
+		Body:   body,
+	}
+
+	if req.Target == "" {
+		req.Target = "/"
+	}
+
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+func (req *Request) validate() error {
+	if !slices.Contains(httpMethods, req.Method) {
+		return fmt.Errorf("unsupported method %q (supported: %s)", req.Method, strings.Join(httpMethods, ", "))
+	}
+
+	if !strings.HasPrefix(req.Target, "/") && !(req.Method == "OPTIONS" && req.Target == "*") {
+		return fmt.Errorf("request target must begin with '/': %q", req.Target)
+	}
+
+	for i := 0; i < len(req.Target); i++ {
+		if c := req.Target[i]; c <= ' ' || c == 0x7f {
+			return fmt.Errorf("invalid character %q in request target %q", c, req.Target)
+		}
+	}
+
+	for name, values := range req.Header {
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		for _, v := range values {
+			if strings.ContainsAny(v, "\r\n") {
+				return fmt.Errorf("invalid header value for %s: %q", name, v)
+			}
+		}
+	}
+
+	return nil
+}
+
+// 送信するHTTPリクエストメッセージを組み立てる。
+// Hostが未設定ならhostを、Content-Lengthはbodyの長さを自動で付ける。
+// keepAliveでなければ、Connectionが未設定ならcloseにする。
+func (req *Request) encode(host string, keepAlive bool) ([]byte, error) {
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+
+	header := Header{}
+	for k, v := range req.Header {
+		header[k] = slices.Clone(v)
+	}
+
+	if header.Get("Host") == "" {
+		header.Set("Host", host)
+	}
+
+	header.Del("Content-Length")
+	if len(req.Body) > 0 || req.Method == "POST" || req.Method == "PUT" || req.Method == "PATCH" {
+		header.Set("Content-Length", strconv.Itoa(len(req.Body)))
+	}
+
+	if header.Get("Connection") == "" && !keepAlive {
+		header.Set("Connection", "close")
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprint(&msg, req.Method, " ", req.Target, " HTTP/1.1", crlf)
+
+	// Hostは先頭に置き、それ以外は名前順に並べる。
+	fmt.Fprint(&msg, "Host: ", header.Get("Host"), crlf)
+	header.Del("Host")
+	for _, k := range slices.Sorted(maps.Keys(header)) {
+		for _, v := range header[k] {
+			fmt.Fprint(&msg, k, ": ", v, crlf)
+		}
+	}
+
+	msg.WriteString(crlf)
+	msg.Write(req.Body)
+
+	return msg.Bytes(), nil
+}
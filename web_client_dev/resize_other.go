@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+)
+
+// SIGWINCHのない環境では大きさの変化を通知しない。
+func notifyResize(ch chan<- os.Signal) {}
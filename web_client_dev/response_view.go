@@ -0,0 +1,416 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// 枠の内側に必要な最小の行数(タブ、区切り線、内容1行、検索の状態)。
+const minResponseHeight = 4
+
+const (
+	tabStatus = iota
+	tabHeader
+	tabBody
+	tabTiming
+)
+
+var responseTabNames = []string{"STATUS", "HEADERS", "BODY", "TIMING"}
+
+const (
+	inverse    = "\x1b[7m"
+	underline  = "\x1b[4m"
+	resetStyle = "\x1b[24;27m"
+)
+
+// SENDで受け取ったレスポンスをタブ(status, headers, body, timing)ごとにスクロールして表示する。
+// bodyは"/"で検索でき、n/Nで次/前のマッチに移動する。
+type ResponseViewer struct {
+	resp *Response
+	err  error
+
+	tab     int
+	offsets [4]int // タブごとの縦のスクロール位置
+	hOffset int    // 折り返さないときの横のスクロール位置
+	wrap    bool
+
+	searching bool   // 検索語の入力中
+	query     string // 入力中の検索語
+	search    string // 確定した検索語
+	matches   []match
+	current   int
+
+	// 最後に描画したときの表示領域の大きさ
+	rows, width int
+}
+
+// 表示行の中でのマッチの位置(runeの位置)。
+type match struct {
+	line, start, end int
+}
+
+func NewResponseViewer(resp *Response, err error) *ResponseViewer {
+	v := &ResponseViewer{resp: resp, err: err, tab: tabBody, wrap: true}
+	if err != nil {
+		v.tab = tabStatus
+	}
+	return v
+}
+
+// エラーの内容。RequestErrorなら失敗した段階と理由の種類を分けて出す。
+func errorLines(err error) []string {
+	var re *RequestError
+	if !errors.As(err, &re) {
+		return append([]string{"ERROR"}, strings.Split(err.Error(), "\n")...)
+	}
+
+	lines := []string{
+		fmt.Sprintf("ERROR: %v", re.Kind),
+		"",
+		fmt.Sprintf("Stage:   %s", re.Stage),
+	}
+	if re.Address != "" {
+		lines = append(lines, fmt.Sprintf("Address: %s", re.Address))
+	}
+	return append(lines, fmt.Sprintf("Detail:  %v", re.Err))
+}
+
+// 選ばれているタブの内容を行に分けて返す。
+func (v *ResponseViewer) sourceLines() []string {
+	var lines []string
+
+	switch {
+	case v.err != nil && v.tab == tabStatus:
+		lines = errorLines(v.err)
+	case v.err != nil:
+		lines = nil
+	case v.tab == tabStatus:
+		lines = []string{
+			v.resp.Status(),
+			"",
+			fmt.Sprintf("Protocol:    %s", v.resp.Proto()),
+			fmt.Sprintf("Status Code: %d", v.resp.StatusCode()),
+			fmt.Sprintf("Reason:      %s", v.resp.Reason()),
+			fmt.Sprintf("Body Size:   %d bytes", len(v.resp.Body())),
+		}
+		if trailer := v.resp.Trailer(); len(trailer) > 0 {
+			lines = append(lines, "", "Trailer:")
+			lines = append(lines, trailer.lines()...)
+		}
+	case v.tab == tabHeader:
+		lines = v.resp.Header().lines()
+	case v.tab == tabBody:
+		lines = strings.Split(v.resp.Body(), "\n")
+	case v.tab == tabTiming:
+		// 横棒は折り返さずに表示領域の幅に合わせる
+		return v.resp.Timing().waterfall(v.width)
+	}
+
+	for i := range lines {
+		lines[i] = sanitize(lines[i])
+	}
+	return lines
+}
+
+// 折り返しの設定に従って、表示する行を作る。
+func (v *ResponseViewer) displayLines(width int) []string {
+	src := v.sourceLines()
+	if !v.wrap {
+		return src
+	}
+
+	var lines []string
+	for _, l := range src {
+		r := []rune(l)
+		if len(r) == 0 {
+			lines = append(lines, "")
+			continue
+		}
+		for len(r) > 0 {
+			n := max(1, indexAtColumn(r, width))
+			lines = append(lines, string(r[:n]))
+			r = r[n:]
+		}
+	}
+	return lines
+}
+
+// lines中のsearchの出現位置を全て探す。
+func findMatches(lines []string, search string) []match {
+	if search == "" {
+		return nil
+	}
+
+	var matches []match
+	for i, l := range lines {
+		for pos := 0; ; {
+			j := strings.Index(l[pos:], search)
+			if j < 0 {
+				break
+			}
+			start := utf8.RuneCountInString(l[:pos+j])
+			matches = append(matches, match{i, start, start + utf8.RuneCountInString(search)})
+			pos += j + len(search)
+		}
+	}
+	return matches
+}
+
+// 1回のキー入力を処理する。Enterでリクエストの編集に戻るときはedit=true、qで終了するときはquit=trueになる。
+func (v *ResponseViewer) HandleKey(k Key) (edit, quit bool) {
+	if v.searching {
+		v.handleSearchKey(k)
+		return false, false
+	}
+
+	lines := v.displayLines(v.width)
+	maxOffset := max(0, len(lines)-v.rows)
+	offset := &v.offsets[v.tab]
+
+	switch k.Code {
+	case KeyEnter:
+		return true, false
+	case KeyUp:
+		*offset--
+	case KeyDown:
+		*offset++
+	case KeyPgUp:
+		*offset -= v.rows
+	case KeyPgDn:
+		*offset += v.rows
+	case KeyHome:
+		*offset = 0
+	case KeyEnd:
+		*offset = maxOffset
+	case KeyLeft:
+		v.hOffset = max(0, v.hOffset-v.width/2)
+	case KeyRight:
+		if !v.wrap {
+			v.hOffset += v.width / 2
+		}
+	case KeyTab:
+		v.tab = (v.tab + 1) % len(responseTabNames)
+	case KeyRune:
+		switch k.Rune {
+		case 'q':
+			return false, true
+		case '1', '2', '3', '4':
+			v.tab = int(k.Rune - '1')
+		case 'w':
+			v.wrap = !v.wrap
+			v.hOffset = 0
+		case '/':
+			v.tab = tabBody
+			v.searching = true
+			v.query = ""
+		case 'n':
+			v.jumpToMatch(v.current + 1)
+		case 'N':
+			v.jumpToMatch(v.current - 1)
+		}
+	}
+
+	v.offsets[v.tab] = max(0, min(v.offsets[v.tab], max(0, len(v.displayLines(v.width))-v.rows)))
+	return false, false
+}
+
+// 検索語の入力中のキー入力を処理する。Enterで確定し、ESCで取り消す。
+func (v *ResponseViewer) handleSearchKey(k Key) {
+	switch k.Code {
+	case KeyEnter:
+		v.searching = false
+		v.search = v.query
+		v.current = 0
+		v.jumpToMatch(0)
+	case KeyEsc:
+		v.searching = false
+	case KeyBackspace:
+		v.query = trimLastCluster(v.query)
+	case KeyRune:
+		v.query += string(k.Rune)
+	}
+}
+
+// i番目のマッチが見えるようにスクロールする。端まで行ったら反対側に戻る。
+func (v *ResponseViewer) jumpToMatch(i int) {
+	v.matches = findMatches(v.displayLines(v.width), v.search)
+	if len(v.matches) == 0 {
+		return
+	}
+
+	v.current = (i%len(v.matches) + len(v.matches)) % len(v.matches)
+	m := v.matches[v.current]
+
+	offset := &v.offsets[tabBody]
+	if m.line < *offset || m.line >= *offset+v.rows {
+		*offset = max(0, m.line-v.rows/2)
+	}
+
+	if !v.wrap && (m.start < v.hOffset || m.end > v.hOffset+v.width) {
+		v.hOffset = max(0, m.start-v.width/4)
+	}
+}
+
+// パネルの枠の内側に描画する、width x heightの行を返す。
+// 上からタブの一覧、区切り線、内容、検索の状態の順に並ぶ。
+func (v *ResponseViewer) Render(width, height int) []string {
+	inner := width - 2
+	v.width = inner
+	v.rows = max(1, height-3)
+
+	lines := v.displayLines(inner)
+	if v.tab == tabBody {
+		v.matches = findMatches(lines, v.search)
+	} else {
+		v.matches = nil
+	}
+	offset := v.offsets[v.tab]
+
+	var out []string
+	out = append(out, " "+v.tabBar(len(lines), offset)+" ")
+	out = append(out, " "+strings.Repeat("─", inner)+" ")
+	for i := 0; i < v.rows; i++ {
+		n := offset + i
+		if n >= len(lines) {
+			out = append(out, strings.Repeat(" ", width))
+			continue
+		}
+		out = append(out, " "+v.highlight(n, lines[n], inner)+" ")
+	}
+	out = append(out, " "+padRight(fitWidth(v.statusMessage(), inner), inner)+" ")
+
+	return out
+}
+
+func (v *ResponseViewer) help() string {
+	return "↑↓/PgUp/PgDn/Home/End: scroll  Tab,1-4: tab  w: wrap  /,n,N: search  Enter: edit  q: quit"
+}
+
+// タブの一覧と折り返しの設定、表示中の行の範囲を並べる。
+func (v *ResponseViewer) tabBar(total, offset int) string {
+	var tabs []string
+	for i, name := range responseTabNames {
+		if i == v.tab {
+			tabs = append(tabs, inverse+" "+name+" "+resetStyle)
+		} else {
+			tabs = append(tabs, " "+name+" ")
+		}
+	}
+
+	wrap := "off"
+	if v.wrap {
+		wrap = "on"
+	}
+
+	last := min(offset+v.rows, total)
+	info := fmt.Sprintf("wrap:%s  lines %d-%d/%d", wrap, min(offset+1, last), last, total)
+
+	bar := strings.Join(tabs, " ")
+	visible := utf8.RuneCountInString(bar) - len(inverse+resetStyle)
+	if gap := v.width - visible - len(info); gap > 0 {
+		bar += strings.Repeat(" ", gap)
+	}
+	return bar + info
+}
+
+func (v *ResponseViewer) statusMessage() string {
+	switch {
+	case v.searching:
+		return "/" + v.query
+	case v.search != "" && len(v.matches) == 0:
+		return fmt.Sprintf("pattern not found: %s", v.search)
+	case v.search != "":
+		return fmt.Sprintf("/%s  match %d/%d", v.search, v.current+1, len(v.matches))
+	}
+	return ""
+}
+
+// 表示行のうち見えている範囲を切り出し、検索のマッチを強調する。
+// 選ばれているマッチは反転、それ以外は下線にする。
+func (v *ResponseViewer) highlight(n int, line string, width int) string {
+	r := []rune(line)
+	start := 0
+	if !v.wrap {
+		start = min(v.hOffset, len(r))
+	}
+
+	style := func(i int) string {
+		for j, m := range v.matches {
+			if m.line == n && m.start <= i && i < m.end {
+				if j == v.current {
+					return inverse
+				}
+				return underline
+			}
+		}
+		return ""
+	}
+
+	var b strings.Builder
+	current := ""
+	x := 0
+	for i := start; i < len(r); {
+		n := clusterLen(r[i:])
+		w := clusterWidth(r[i : i+n])
+		if x+w > width {
+			break
+		}
+		if s := style(i); s != current {
+			b.WriteString(resetStyle + s)
+			current = s
+		}
+		b.WriteString(string(r[i : i+n]))
+		x += w
+		i += n
+	}
+	if current != "" {
+		b.WriteString(resetStyle)
+	}
+	b.WriteString(strings.Repeat(" ", width-x))
+
+	return b.String()
+}
+
+// widthに収まるように切り詰める。
+func fitWidth(s string, width int) string {
+	var b strings.Builder
+	w := 0
+	for _, c := range clusters([]rune(s)) {
+		w += clusterWidth(c)
+		if w > width {
+			break
+		}
+		b.WriteString(string(c))
+	}
+	return b.String()
+}
+
+func padRight(s string, width int) string {
+	if n := stringWidth(s); n < width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	return s
+}
+
+// 端末の表示を崩す制御文字を取り除く。タブは空白にする。
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t':
+			return ' '
+		case r < ' ' || r == 0x7f:
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func centering(s string, width int) string {
+	w := width - stringWidth(s)
+	if w <= 0 {
+		return s
+	}
+	return strings.Repeat(" ", w/2) + s + strings.Repeat(" ", w-w/2)
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	sidebarMinScreenWidth = 100 // これより狭い端末ではサイドバーを出さない
+	sidebarWidth          = 28
+)
+
+const (
+	CtrlB uint8 = 2
+	CtrlS uint8 = 19
+)
+
+// 保存したリクエストをフォルダごとに並べるサイドバー。
+// 読み込みや保存などの操作はAlternateBufferが行う。
+type CollectionList struct {
+	c       *Collection
+	sel     int    // 選んでいるリクエストの位置(c.Requestsの添字)
+	loaded  string // 編集中のリクエストの名前
+	top     int
+	focused bool
+}
+
+// サイドバーの1行。フォルダの行はindexが-1になる。
+type sidebarRow struct {
+	text  string
+	index int
+}
+
+func (l *CollectionList) rows() []sidebarRow {
+	var rows []sidebarRow
+	folder := ""
+	for i, r := range l.c.Requests {
+		if f := r.Folder(); f != folder {
+			rows = append(rows, sidebarRow{"▾ " + f + "/", -1})
+			folder = f
+		}
+
+		mark := "  "
+		if r.Name == l.loaded {
+			mark = "* "
+		}
+		indent := ""
+		if folder != "" {
+			indent = "  "
+		}
+		rows = append(rows, sidebarRow{indent + mark + r.BaseName(), i})
+	}
+	return rows
+}
+
+// 選んでいるリクエスト。
+func (l *CollectionList) Selected() (SavedRequest, bool) {
+	if l.sel < 0 || l.sel >= len(l.c.Requests) {
+		return SavedRequest{}, false
+	}
+	return l.c.Requests[l.sel], true
+}
+
+// nameのリクエストを選ぶ。なければ選んでいる位置を一覧に収める。
+func (l *CollectionList) Select(name string) {
+	if i := l.c.Index(name); i >= 0 {
+		l.sel = i
+	}
+	l.sel = max(0, min(l.sel, len(l.c.Requests)-1))
+}
+
+func (l *CollectionList) HandleKey(k Key) bool {
+	switch k.Code {
+	case KeyUp:
+		l.sel--
+	case KeyDown:
+		l.sel++
+	case KeyPgUp:
+		l.sel -= 10
+	case KeyPgDn:
+		l.sel += 10
+	case KeyHome:
+		l.sel = 0
+	case KeyEnd:
+		l.sel = len(l.c.Requests) - 1
+	default:
+		return false
+	}
+	l.sel = max(0, min(l.sel, len(l.c.Requests)-1))
+	return true
+}
+
+func (l *CollectionList) Render(width, height int) ([]string, int, int) {
+	rows := l.rows()
+	if len(rows) == 0 {
+		return []string{dim + fitWidth("no saved requests", width) + resetDim, dim + fitWidth("^S: save", width) + resetDim}, 0, 0
+	}
+
+	// 選んでいる行が見えるようにスクロールする。フォルダの行も一緒に見せる。
+	cur := slices.IndexFunc(rows, func(r sidebarRow) bool { return r.index == l.sel })
+	if cur-1 < l.top {
+		l.top = max(0, cur-1)
+	}
+	if cur >= l.top+height {
+		l.top = cur - height + 1
+	}
+	l.top = max(0, min(l.top, len(rows)-height))
+
+	var lines []string
+	for i := l.top; i < min(l.top+height, len(rows)); i++ {
+		line := padRight(fitWidth(sanitize(rows[i].text), width), width)
+		switch {
+		case i == cur && l.focused:
+			line = inverse + line + resetStyle
+		case i == cur:
+			line = underline + line + resetStyle
+		}
+		lines = append(lines, line)
+	}
+	return lines, 0, 0
+}
+
+// 編集中のリクエストをnameで保存する。
+func (ab *AlternateBuffer) saveRequest(name string) {
+	r := SavedRequest{
+		Name:        name,
+		RequestLine: ab.line.String(),
+		Headers:     ab.headers.Fields(),
+		Body:        ab.body.String(),
+	}
+	if err := ab.collection.c.Put(r); err != nil {
+		ab.message = err.Error()
+		return
+	}
+
+	name, _ = cleanRequestName(name)
+	ab.collection.loaded = name
+	ab.collection.Select(name)
+	ab.storeCollection(fmt.Sprintf("saved %q", name))
+}
+
+// コレクションをファイルに書き出し、結果をmsgか失敗した理由で知らせる。
+func (ab *AlternateBuffer) storeCollection(msg string) {
+	if err := ab.collection.c.Save(); err != nil {
+		ab.message = fmt.Sprintf("cannot save collection: %v", err)
+		return
+	}
+	ab.message = msg
+}
+
+// 保存したリクエストを入力欄に読み込む。
+func (ab *AlternateBuffer) loadRequest(r SavedRequest) {
+	ab.line.SetText(r.RequestLine)
+	ab.headers = NewHeaderTable(slices.Clone(r.Headers))
+	ab.body.SetText(r.Body)
+	ab.syncRequest()
+
+	ab.collection.loaded = r.Name
+	ab.message = fmt.Sprintf("loaded %q", r.Name)
+	ab.setFocus(focusRequestLine)
+	ab.draw()
+}
+
+// サイドバーでのキー入力を処理する。使わないキーならfalseを返す。
+func (ab *AlternateBuffer) handleCollectionKey(k Key) bool {
+	r, ok := ab.collection.Selected()
+
+	switch {
+	case k.Code == KeyRune && k.Rune == 's':
+		ab.ask("Save as: ", ab.collection.loaded, ab.saveRequest)
+	case !ok:
+		return false
+	case k.Code == KeyEnter:
+		ab.loadRequest(r)
+	case k.Code == KeyRune && k.Rune == 'c':
+		name, err := ab.collection.c.Duplicate(r.Name)
+		if err != nil {
+			ab.message = err.Error()
+			break
+		}
+		ab.collection.Select(name)
+		ab.storeCollection(fmt.Sprintf("duplicated %q as %q", r.Name, name))
+	case k.Code == KeyRune && k.Rune == 'r':
+		ab.ask("Rename to: ", r.Name, func(name string) {
+			if err := ab.collection.c.Rename(r.Name, name); err != nil {
+				ab.message = err.Error()
+				return
+			}
+			name, _ = cleanRequestName(name)
+			if ab.collection.loaded == r.Name {
+				ab.collection.loaded = name
+			}
+			ab.collection.Select(name)
+			ab.storeCollection(fmt.Sprintf("renamed %q to %q", r.Name, name))
+		})
+	case k.Code == KeyDelete || k.Code == KeyRune && k.Rune == 'd':
+		ab.ask(fmt.Sprintf("Delete %q? (y/N) ", r.Name), "", func(answer string) {
+			if !strings.EqualFold(strings.TrimSpace(answer), "y") {
+				return
+			}
+			ab.collection.c.Delete(r.Name)
+			if ab.collection.loaded == r.Name {
+				ab.collection.loaded = ""
+			}
+			ab.collection.Select("")
+			ab.storeCollection(fmt.Sprintf("deleted %q", r.Name))
+		})
+	default:
+		return false
+	}
+	return true
+}
+
+// サイドバーの表示を切り替える。
+func (ab *AlternateBuffer) toggleSidebar() {
+	ab.showSidebar = !ab.showSidebar
+	ab.layout = newScreenLayout(ab.width, ab.height, ab.showSidebar)
+	if ab.focus == focusCollection && !ab.layout.hasSidebar {
+		ab.setFocus(focusRequestLine)
+	}
+	fmt.Print(Clear)
+	ab.draw()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+// リクエストの段階ごとの制限時間。0なら制限しない。
+type Timeouts struct {
+	DNS          time.Duration // 名前解決
+	Connect      time.Duration // TCPの接続
+	TLSHandshake time.Duration // TLSのハンドシェイク
+	Write        time.Duration // リクエストメッセージの送信
+	FirstByte    time.Duration // 送り終えてからレスポンスの最初のバイトが届くまで
+	Read         time.Duration // 最初のバイトの後、次のデータが届くまでの間隔
+	Total        time.Duration // 接続からbodyを読み終えるまでの全体
+}
+
+var DefaultTimeouts = Timeouts{
+	DNS:          10 * time.Second,
+	Connect:      10 * time.Second,
+	TLSHandshake: 10 * time.Second,
+	Write:        30 * time.Second,
+	FirstByte:    60 * time.Second,
+	Read:         30 * time.Second,
+}
+
+// キャンセルされた接続の読み書きをすぐに失敗させるための、過去の時刻。
+var aLongTimeAgo = time.Unix(1, 0)
+
+// dが0より大きければ、その時間で終わるctxを返す。
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// 今からdだけ後の時刻。dが0なら期限なしを表すゼロ値を返す。
+func deadlineAfter(d time.Duration) time.Time {
+	if d <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(d)
+}
+
+// 名前を解決して接続し、httpsならTLSのハンドシェイクまでを済ませる。
+// アドレスが複数あれば、接続できるまで順に試す。それぞれの段階の時刻をtに記録する。
+func (c HTTPClient) dial(ctx context.Context, t *Timing) (net.Conn, error) {
+	addrs := []string{c.target}
+	if net.ParseIP(c.target) == nil {
+		dnsCtx, cancel := withTimeout(ctx, c.timeouts.DNS)
+		var err error
+		t.DNSStart = time.Now()
+		addrs, err = net.DefaultResolver.LookupHost(dnsCtx, c.target)
+		t.DNSDone = time.Now()
+		cancel()
+		if err != nil {
+			return nil, contextError(ctx, newRequestError(StageDNS, c.address, nil, err))
+		}
+	}
+
+	connectCtx, cancel := withTimeout(ctx, c.timeouts.Connect)
+	defer cancel()
+	var d net.Dialer
+	var conn net.Conn
+	var err error
+	t.ConnectStart = time.Now()
+	for _, addr := range addrs {
+		if conn, err = d.DialContext(connectCtx, "tcp", net.JoinHostPort(addr, c.port)); err == nil {
+			break
+		}
+	}
+	t.ConnectDone = time.Now()
+	if err != nil {
+		return nil, contextError(ctx, newRequestError(StageConnect, c.address, nil, err))
+	}
+
+	if !c.useTLS {
+		return conn, nil
+	}
+	tlsCtx, cancel := withTimeout(ctx, c.timeouts.TLSHandshake)
+	defer cancel()
+	tc := tls.Client(conn, &tls.Config{ServerName: c.target})
+	t.TLSStart = time.Now()
+	err = tc.HandshakeContext(tlsCtx)
+	t.TLSDone = time.Now()
+	if err != nil {
+		conn.Close()
+		kind := classifyError(err)
+		if kind == ErrNetwork {
+			kind = ErrTLS
+		}
+		return nil, contextError(ctx, newRequestError(StageTLS, c.address, kind, err))
+	}
+	return tc, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 1回のリクエストの段階ごとの時刻。行わなかった段階はゼロ値のままになる。
+type Timing struct {
+	Start        time.Time
+	DNSStart     time.Time
+	DNSDone      time.Time
+	ConnectStart time.Time
+	ConnectDone  time.Time
+	TLSStart     time.Time
+	TLSDone      time.Time
+	WriteStart   time.Time
+	WroteRequest time.Time
+	FirstByte    time.Time
+	BodyDone     time.Time
+	Reused       bool // プールの接続を使い回したので、名前解決と接続をしていない
+}
+
+// Timingの1つの段階。
+type TimingPhase struct {
+	Name       string
+	Start, End time.Time
+}
+
+func (p TimingPhase) Duration() time.Duration {
+	return p.End.Sub(p.Start)
+}
+
+// 行った段階を順に返す。
+func (t Timing) Phases() []TimingPhase {
+	all := []TimingPhase{
+		{"DNS", t.DNSStart, t.DNSDone},
+		{"Connect", t.ConnectStart, t.ConnectDone},
+		{"TLS", t.TLSStart, t.TLSDone},
+		{"Send", t.WriteStart, t.WroteRequest},
+		{"Wait", t.WroteRequest, t.FirstByte},
+		{"Download", t.FirstByte, t.BodyDone},
+	}
+
+	var phases []TimingPhase
+	for _, p := range all {
+		if !p.Start.IsZero() && !p.End.IsZero() {
+			phases = append(phases, p)
+		}
+	}
+	return phases
+}
+
+// 始めてから最後の段階が終わるまでの時間。
+func (t Timing) Total() time.Duration {
+	var end time.Time
+	for _, p := range t.Phases() {
+		if p.End.After(end) {
+			end = p.End
+		}
+	}
+	if end.IsZero() {
+		return 0
+	}
+	return end.Sub(t.Start)
+}
+
+// 段階ごとの時間を、始めてからの経過時間に合わせて横棒で並べる。
+// "Connect    1.2ms  |  ████              |"
+func (t Timing) waterfall(width int) []string {
+	phases := t.Phases()
+	if len(phases) == 0 {
+		return []string{"no timing"}
+	}
+
+	const nameWidth, durationWidth = 9, 10
+	barWidth := max(10, width-nameWidth-durationWidth-4)
+	total := t.Total()
+	col := func(at time.Time) int {
+		if total <= 0 {
+			return 0
+		}
+		return min(barWidth, int(int64(at.Sub(t.Start))*int64(barWidth)/int64(total)))
+	}
+
+	var lines []string
+	for _, p := range phases {
+		start := col(p.Start)
+		n := max(1, col(p.End)-start)
+		start = min(start, barWidth-n)
+		bar := strings.Repeat(" ", start) + strings.Repeat("█", n) + strings.Repeat(" ", barWidth-start-n)
+		lines = append(lines, fmt.Sprintf("%-*s%*s  |%s|", nameWidth, p.Name, durationWidth, formatMillis(p.Duration()), bar))
+	}
+	lines = append(lines, fmt.Sprintf("%-*s%*s", nameWidth, "Total", durationWidth, formatMillis(total)))
+	if t.Reused {
+		lines = append(lines, "(reused a pooled connection)")
+	}
+	return lines
+}
+
+// dを小数点以下1桁のミリ秒で表す。
+func formatMillis(d time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+}
+
+// JSONで出すための、段階ごとのミリ秒。
+func (t Timing) millis() map[string]float64 {
+	m := map[string]float64{}
+	for _, p := range t.Phases() {
+		m[strings.ToLower(p.Name)] = float64(p.Duration()) / float64(time.Millisecond)
+	}
+	m["total"] = float64(t.Total()) / float64(time.Millisecond)
+	return m
+}
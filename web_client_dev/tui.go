@@ -1,9 +1,14 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"slices"
+	"strings"
 
 	"golang.org/x/term"
 )
@@ -19,458 +24,526 @@ const (
 
 	Blink = "\x1b[5m"
 
-	CursorDownESC  = "\x1b[1B"
-	CursorRightESC = "\x1b[1C"
-
 	Tab       uint8 = 9
 	Enter     uint8 = 13
 	Backspace uint8 = 127
+	CtrlC     uint8 = 3
+	CtrlD     uint8 = 4
 	CtrlH     uint8 = 8
 	CtrlU     uint8 = 21
 )
 
+// Ctrl-CかCtrl-Dで終了するときにReadKeyが返す。
+var errQuit = errors.New("quit")
+
 type RequestContent struct {
-	requestLine              string
-	requestHeaderHost        string
-	requestHeaderContentType string
-	requestBody              string
+	requestLine string
+	headers     []HeaderField
+	requestBody string
 }
 
-type AlternateBuffer struct {
-	fd                            int
-	OldState                      *term.State
-	width, height, vPoint, hPoint int
-	t                             *term.Terminal
-	rw                            *TerminalReadWriter
-	tuiText                       string
-	tabCount                      int
-	rc                            *RequestContent
-	scs                           bool
-}
+// "METHOD TARGET [HTTP-version]"のrequest lineとHostからHTTPClientとRequestを作る。
+// Hostにポートがなければ80番につなぐ。
+func (rc *RequestContent) build() (*HTTPClient, *Request, error) {
+	fields := strings.Fields(rc.requestLine)
+	if len(fields) < 2 || len(fields) > 3 {
+		return nil, nil, fmt.Errorf("request line must be \"METHOD TARGET [HTTP/1.1]\": %q", rc.requestLine)
+	}
+	if len(fields) == 3 && fields[2] != "HTTP/1.1" {
+		return nil, nil, fmt.Errorf("unsupported HTTP version %q", fields[2])
+	}
 
-func NewAlternateBuffer() *AlternateBuffer {
-	fd := int(os.Stdin.Fd())
-	OldState, err := term.GetState(fd)
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	// 有効な行だけをヘッダーにする。同じ名前の行は上から順に値を並べる。
+	var host string
+	header := Header{}
+	for _, f := range rc.headers {
+		name := strings.TrimSpace(f.Name)
+		if !f.Enabled || name == "" {
+			continue
+		}
+		if strings.EqualFold(name, "Host") {
+			host = strings.TrimSpace(f.Value)
+			continue
+		}
+		header.Add(name, strings.TrimSpace(f.Value))
 	}
 
-	_, err = term.MakeRaw(fd)
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	if host == "" {
+		return nil, nil, errors.New("Host is empty")
 	}
 
-	w, h, err := term.GetSize(fd)
+	target, port, err := parseHostPort(host, defaultPorts["http"])
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return nil, nil, fmt.Errorf("Host: %w", err)
 	}
 
-	t, rw := NewTerminal(w, h)
-
-	return &AlternateBuffer{
-		fd:       fd,
-		OldState: OldState,
-		width:    w,
-		height:   h,
-		t:        t,
-		rw:       rw,
-		rc:       &RequestContent{},
-		scs:      true,
+	req, err := NewRequest(fields[0], fields[1], []byte(rc.requestBody))
+	if err != nil {
+		return nil, nil, err
 	}
-}
-
-type TerminalReadWriter struct {
-	io.Reader
-	io.Writer
-}
+	req.Header = header
+	req.Header.Set("Host", host)
 
-func NewTerminalReadWriter() *TerminalReadWriter {
-	return &TerminalReadWriter{os.Stdin, os.Stdout}
+	return NewHTTPClient(target, port), req, nil
 }
 
-func NewTerminal(w, h int) (*term.Terminal, *TerminalReadWriter) {
-	rw := NewTerminalReadWriter()
-	t := term.NewTerminal(rw, Blink)
+const (
+	modeInput    = iota // 入力欄やボタンを操作している
+	modeResponse        // レスポンスを見ている
+	modeHistory         // 履歴の一覧を見ている
+)
 
-	t.SetSize(w, h)
-	return t, rw
+type AlternateBuffer struct {
+	fd            int
+	OldState      *term.State
+	width, height int
+	t             *term.Terminal
+	rw            *TerminalReadWriter
+	layout        *screenLayout
+	events        chan inputEvent
+	mode          int
+	focus         focusID
+	rc            *RequestContent
+	line          *LineEditor
+	headers       *HeaderTable
+	body          *TextEditor
+	send, cancel  *Button
+	collection    *CollectionList
+	showSidebar   bool
+	env           *Environment // 選んでいる環境。nilなら変数を展開しない
+	preview       bool         // trueならレスポンスの代わりに展開したリクエストを出す
+	viewer        *ResponseViewer
+	history       *History    // nilなら履歴を記録しない
+	policy        *PortPolicy // nilならどのポートにも接続する
+	pool          *ConnPool
+	historyView   *HistoryBrowser
+	prompt        *prompt
+	cancelRequest context.CancelFunc // 送っている途中のリクエストをやめる。送っていなければnil
+	message       string             // 操作の結果。次のキー入力まで操作説明の代わりに出す
+}
+
+// キー入力か端末の大きさの変化。
+type inputEvent struct {
+	key    Key
+	err    error
+	resize bool
+	result *requestResult // 送ったリクエストの結果
+}
+
+type requestResult struct {
+	resp *Response
+	err  error
 }
 
-func (ab *AlternateBuffer) Enter() {
-
-	ab.t.Write([]byte(EnterESC))
-	ab.t.Write([]byte(StrRed))
-	ab.t.Write([]byte(BgBlack))
-	ab.t.Write([]byte(Clear))
+const (
+	minScreenWidth = 40
+	wideScreen     = 120
+)
 
-	ab.DrawTUI()
+// 端末の大きさに合わせて計算した、各パネルと入力欄の位置。
+type screenLayout struct {
+	sidebar  *Panel
+	request  *Panel
+	response *Panel
 
-	defer ab.Restore()
-}
+	hasSidebar bool
+	collection Rect
 
-func (ab *AlternateBuffer) DrawTUI() {
-	ab.vPoint = ab.height / 4
-	ab.hPoint = int(float32(ab.width) / 3.3)
-
-	// TODO: 分割して関数で文字列を構築できるようにする。
-	// TODO: 枠と文字を色を変える。
-	ab.tuiText = fmt.Sprint(
-		"\x1b[", ab.vPoint+1, ";", ab.hPoint, "H", "┏━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━ HTTP REQUEST MESSAGE ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━┓",
-		"\x1b[", ab.vPoint+2, ";", ab.hPoint, "H", "┃                                                                                                ┃",
-		"\x1b[", ab.vPoint+3, ";", ab.hPoint, "H", "┣━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━ REQUEST LINE ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━┫",
-		"\x1b[", ab.vPoint+4, ";", ab.hPoint, "H", "┃                                                                                                ┃",
-		"\x1b[", ab.vPoint+5, ";", ab.hPoint, "H", "┃                                                                                                ┃",
-		"\x1b[", ab.vPoint+6, ";", ab.hPoint, "H", "┃                                                                                                ┃",
-		"\x1b[", ab.vPoint+7, ";", ab.hPoint, "H", "┃                                                                                                ┃",
-		"\x1b[", ab.vPoint+8, ";", ab.hPoint, "H", "┃                                                                                                ┃",
-		"\x1b[", ab.vPoint+6, ";", ab.hPoint, "H", "┃                                                                                                ┃",
-		"\x1b[", ab.vPoint+7, ";", ab.hPoint, "H", "┃                                                                                                ┃",
-		"\x1b[", ab.vPoint+8, ";", ab.hPoint, "H", "┃                                                                                                ┃",
-		"\x1b[", ab.vPoint+9, ";", ab.hPoint, "H", "┣━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━ REQUEST HEADER ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━┫",
-		"\x1b[", ab.vPoint+10, ";", ab.hPoint, "H", "┃                                                                                                ┃",
-		"\x1b[", ab.vPoint+11, ";", ab.hPoint, "H", "┃ Host:                                                                                          ┃",
-		"\x1b[", ab.vPoint+12, ";", ab.hPoint, "H", "┃ Content-type:                                                                                  ┃",
-		"\x1b[", ab.vPoint+13, ";", ab.hPoint, "H", "┃                                                                                                ┃",
-		"\x1b[", ab.vPoint+14, ";", ab.hPoint, "H", "┃                                                                                                ┃",
-		"\x1b[", ab.vPoint+15, ";", ab.hPoint, "H", "┣━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━ REQUEST BODY ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━┫",
-		"\x1b[", ab.vPoint+16, ";", ab.hPoint, "H", "┃                                                                                                ┃",
-		"\x1b[", ab.vPoint+17, ";", ab.hPoint, "H", "┃                                                                                                ┃",
-		"\x1b[", ab.vPoint+18, ";", ab.hPoint, "H", "┃                                                                                                ┃",
-		"\x1b[", ab.vPoint+19, ";", ab.hPoint, "H", "┃                                                                                                ┃",
-		"\x1b[", ab.vPoint+20, ";", ab.hPoint, "H", "┃                                                                                                ┃",
-		"\x1b[", ab.vPoint+21, ";", ab.hPoint, "H", "┃                                                                                                ┃",
-		"\x1b[", ab.vPoint+22, ";", ab.hPoint, "H", "┃                                                                                                ┃",
-		"\x1b[", ab.vPoint+23, ";", ab.hPoint, "H", "┃                                                                                                ┃",
-		"\x1b[", ab.vPoint+24, ";", ab.hPoint, "H", "┗━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━┛",
-		"\x1b[", ab.vPoint+25, ";", ab.hPoint, "H", "                                                                                                  ",
-		"\x1b[", ab.vPoint+26, ";", ab.hPoint, "H", "                                                                                                  ",
-		"\x1b[", ab.vPoint+27, ";", ab.hPoint, "H", "                             +   SEND   +                x  CANCEL  x                             ",
-	)
-	fmt.Print(ab.tuiText)
+	requestLine, header, body Rect
 
-	ab.InputRequestContent(ab.vPoint, ab.hPoint)
-	ab.ReadEnter()
-}
+	buttons      Rect
+	send, cancel Rect
+	help         Rect
 
-func (ab AlternateBuffer) resetInverseSendAndCancel() {
-	ab._resetInverseSend()
-	ab._resetInverseCancel()
+	tooSmall  bool
+	minHeight int
 }
 
-func (ab AlternateBuffer) _resetInverseSend() {
-	ab._moveCursorSend()
-	fmt.Print("\x1b[27mSEND")
-}
+// 幅が十分あればリクエストとレスポンスを左右に、なければ上下に並べる。
+// sidebarがtrueで幅が足りれば、左端に保存したリクエストの一覧を置く。
+// 下の2行はSEND/CANCELのボタンと操作説明に使う。
+func newScreenLayout(width, height int, sidebar bool) *screenLayout {
+	l := &screenLayout{}
 
-func (ab AlternateBuffer) _resetInverseCancel() {
-	ab._moveCursorCancel()
-	fmt.Print("\x1b[27mCANCEL")
-}
+	main := Rect{1, 1, width, height - 2}
+	if sidebar && width >= sidebarMinScreenWidth {
+		l.sidebar = NewPanel("COLLECTION", Rect{1, 1, sidebarWidth, height - 2}, &Section{})
+		l.hasSidebar = true
+		main = Rect{1, sidebarWidth + 1, width - sidebarWidth, height - 2}
+	}
 
-func (ab AlternateBuffer) _visibleCursor() {
-	fmt.Print("\x1b[?25h")
-}
+	var panes []Rect
+	if main.Width >= wideScreen {
+		panes = main.SplitColumns(2, 3)
+	} else {
+		panes = main.SplitRows(1, 1)
+	}
 
-func (ab AlternateBuffer) _hiddenCursor() {
-	fmt.Print("\x1b[?25l")
-}
+	l.request = NewPanel("HTTP REQUEST MESSAGE", panes[0],
+		&Section{Title: "REQUEST LINE", Rows: 1},
+		&Section{Title: "REQUEST HEADER", Weight: 1},
+		&Section{Title: "REQUEST BODY", Weight: 2},
+	)
+	l.response = NewPanel("HTTP RESPONSE MESSAGE", panes[1], &Section{})
 
-func (ab AlternateBuffer) RenderingRequestLine() {
-	ab.moveCursorRequestLine()
-	fmt.Print(ab.rc.requestLine)
-}
+	if main.Width >= wideScreen {
+		l.minHeight = max(l.request.MinHeight(), minResponseHeight+2) + 2
+	} else {
+		l.minHeight = 2*max(l.request.MinHeight(), minResponseHeight+2) + 2
+	}
+	if width < minScreenWidth || height < l.minHeight {
+		l.tooSmall = true
+		return l
+	}
 
-func (ab AlternateBuffer) RenderingRequestHeaderHost() {
-	ab.moveCursorRequestHeaderHost()
-	fmt.Print(ab.rc.requestHeaderHost)
-}
+	line := l.request.Sections[0].Rect
+	header := l.request.Sections[1].Rect
+	body := l.request.Sections[2].Rect
+	l.requestLine = Rect{line.Row, line.Col + 1, line.Width - 2, 1}
+	l.header = Rect{header.Row, header.Col + 1, header.Width - 2, header.Height}
+	l.body = Rect{body.Row, body.Col + 1, body.Width - 2, body.Height}
+	if l.hasSidebar {
+		list := l.sidebar.Sections[0].Rect
+		l.collection = Rect{list.Row, list.Col + 1, list.Width - 2, list.Height}
+	}
 
-func (ab AlternateBuffer) RenderingRequestHeaderContentType() {
-	ab.moveCursorRequestHeaderContentType()
-	fmt.Print(ab.rc.requestHeaderContentType)
-}
+	l.buttons = Rect{height - 1, 1, width, 1}
+	l.send = Rect{height - 1, width/2 - 16, 12, 1}
+	l.cancel = Rect{height - 1, width/2 + 4, 12, 1}
+	l.help = Rect{height, 1, width, 1}
 
-func (ab AlternateBuffer) RenderingRequestBody() {
-	ab.moveCursorRequestBody()
-	fmt.Print(ab.rc.requestBody)
+	return l
 }
 
-func (ab *AlternateBuffer) InputRequestContent(vPoint, hPoint int) {
-	ab._visibleCursor()
-	ab.InputRequestLine()
-	ab.InputRequestHeaderHost()
-	ab.InputRequestHeaderContentType()
-	ab.InputRequestBody()
+// 起動したときのヘッダーの一覧。
+var defaultHeaders = []HeaderField{
+	{Name: "Host", Enabled: true},
+	{Name: "Content-Type", Enabled: true},
 }
 
-func (ab *AlternateBuffer) InputRequestLine() {
-	ab.moveCursorRequestLine()
-	ab.ReadLine()
-}
+// 端末をrawモードにしてAlternateBufferを作る。端末でなければエラーを返す。
+func NewAlternateBuffer() (*AlternateBuffer, error) {
+	fd := int(os.Stdin.Fd())
+	OldState, err := term.GetState(fd)
+	if err != nil {
+		return nil, err
+	}
 
-func (ab *AlternateBuffer) InputRequestHeaderHost() {
-	ab.moveCursorRequestHeaderHost()
-	ab.ReadLine()
-}
+	w, h, err := term.GetSize(fd)
+	if err != nil {
+		return nil, err
+	}
 
-func (ab *AlternateBuffer) InputRequestHeaderContentType() {
-	ab.moveCursorRequestHeaderContentType()
-	ab.ReadLine()
-}
+	if _, err := term.MakeRaw(fd); err != nil {
+		return nil, err
+	}
 
-func (ab *AlternateBuffer) InputRequestBody() {
-	ab.moveCursorRequestBody()
-	ab.ReadLine()
-}
+	t, rw := NewTerminal(w, h)
 
-func (ab AlternateBuffer) MoveCursorRequestContent() {
-	if ab.tabCount == 0 {
-		ab.moveCursorRequestLine()
+	// コレクションを読めなくても、空のコレクションで起動して理由を知らせる。
+	var message string
+	path, err := defaultCollectionPath()
+	if err != nil {
+		message = fmt.Sprintf("cannot find collection: %v", err)
 	}
-
-	if ab.tabCount == 1 {
-		ab.RenderingRequestLine()
-		ab.moveCursorRequestHeaderHost()
+	c, err := LoadCollection(path)
+	if err != nil {
+		message = fmt.Sprintf("cannot load collection: %v", err)
 	}
-
-	if ab.tabCount == 2 {
-		ab.RenderingRequestLine()
-		ab.RenderingRequestHeaderHost()
-		ab.moveCursorRequestHeaderContentType()
+	var policy *PortPolicy
+	if path, err := defaultPortPolicyPath(); err == nil {
+		if policy, err = LoadPortPolicy(path); err != nil {
+			message = fmt.Sprintf("cannot load port policy: %v", err)
+		}
 	}
-
-	if ab.tabCount == 3 {
-		ab.RenderingRequestLine()
-		ab.RenderingRequestHeaderHost()
-		ab.RenderingRequestHeaderContentType()
-		ab.moveCursorRequestBody()
+	var history *History
+	if path, err := defaultHistoryPath(); err != nil {
+		message = fmt.Sprintf("cannot find history: %v", err)
+	} else {
+		history = NewHistory(path)
 	}
-}
 
-func (ab AlternateBuffer) moveCursorRequestLine() {
-	v := ab.vPoint + 5
-	h := ab.hPoint + 17
-
-	ab.moveCursor(v, h)
+	return &AlternateBuffer{
+		fd:          fd,
+		OldState:    OldState,
+		width:       w,
+		height:      h,
+		t:           t,
+		rw:          rw,
+		layout:      newScreenLayout(w, h, true),
+		events:      make(chan inputEvent),
+		rc:          &RequestContent{headers: slices.Clone(defaultHeaders)},
+		line:        NewLineEditor(""),
+		headers:     NewHeaderTable(defaultHeaders),
+		body:        NewTextEditor(""),
+		send:        &Button{Label: "SEND", Frame: "+"},
+		cancel:      &Button{Label: "CANCEL", Frame: "x"},
+		collection:  &CollectionList{c: c},
+		history:     history,
+		policy:      policy,
+		pool:        NewConnPool(DefaultPoolConfig),
+		showSidebar: true,
+		focus:       focusRequestLine,
+		message:     message,
+	}, nil
 }
 
-func (ab AlternateBuffer) moveCursorRequestHeaderHost() {
-	v := ab.vPoint + 10
-	h := ab.hPoint + 17
-
-	ab.moveCursor(v, h)
+type TerminalReadWriter struct {
+	*bufio.Reader
+	io.Writer
 }
 
-func (ab AlternateBuffer) moveCursorRequestHeaderContentType() {
-	v := ab.vPoint + 11
-	h := ab.hPoint + 17
-
-	ab.moveCursor(v, h)
+func NewTerminalReadWriter() *TerminalReadWriter {
+	return &TerminalReadWriter{bufio.NewReader(os.Stdin), os.Stdout}
 }
 
-func (ab AlternateBuffer) moveCursorRequestBody() {
-	v := ab.vPoint + 16
-	h := ab.hPoint + 1
+func NewTerminal(w, h int) (*term.Terminal, *TerminalReadWriter) {
+	rw := NewTerminalReadWriter()
+	t := term.NewTerminal(rw, Blink)
 
-	ab.moveCursor(v, h)
+	t.SetSize(w, h)
+	return t, rw
 }
 
-func (ab AlternateBuffer) moveCursorSendOrCancel() {
-	ab._hiddenCursor()
-	ab.resetInverseSendAndCancel()
-	if ab.scs == true {
-		ab._moveCursorSend()
-		fmt.Print("\x1b[7mSEND")
-	} else {
-		ab._moveCursorCancel()
-		fmt.Print("\x1b[7mCANCEL")
-	}
-}
+// 画面を開いてキー入力を処理する。終了したら端末を元に戻す。
+// Ctrl-Cなどで終了したときはnilを、キー入力を読めなくなったときはそのエラーを返す。
+func (ab *AlternateBuffer) Enter() (err error) {
+	defer func() {
+		if rerr := ab.Restore(); err == nil {
+			err = rerr
+		}
+	}()
 
-func (ab AlternateBuffer) _moveCursorSend() {
-	v := ab.vPoint + 26
-	h := ab.hPoint + 32
+	ab.t.Write([]byte(EnterESC))
+	ab.t.Write([]byte(StrRed))
+	ab.t.Write([]byte(BgBlack))
+	ab.t.Write([]byte(Clear))
+	ab.t.Write([]byte(EnableBracketedPaste))
+
+	ab.startInput()
+	ab.draw()
 
-	ab.moveCursor(v, h)
+	// キー入力をフォーカスのある部品かレスポンスの表示に渡す。CANCELかqで終了する。
+	for {
+		k, err := ab.ReadKey()
+		if errors.Is(err, errQuit) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if ab.handleKey(k) {
+			return nil
+		}
+	}
 }
 
-func (ab AlternateBuffer) _moveCursorCancel() {
-	v := ab.vPoint + 26
-	h := ab.hPoint + 59
+// キー入力と端末の大きさの変化をab.eventsに流す。
+func (ab *AlternateBuffer) startInput() {
+	go func() {
+		for {
+			k, err := ab.rw.ReadKey()
+			ab.events <- inputEvent{key: k, err: err}
+			if err != nil {
+				return
+			}
+		}
+	}()
 
-	ab.moveCursor(v, h)
+	sig := make(chan os.Signal, 1)
+	notifyResize(sig)
+	go func() {
+		for range sig {
+			ab.events <- inputEvent{resize: true}
+		}
+	}()
 }
 
-func (ab AlternateBuffer) moveCursor(vPoint, hPoint int) {
-	ab.t.Write([]byte(Home))
+// 次のキー入力を待つ。その間に端末の大きさが変われば、レイアウトを計算し直して再描画する。
+// Ctrl-CかCtrl-Dが押されたらerrQuitを返す。
+func (ab *AlternateBuffer) ReadKey() (Key, error) {
+	for {
+		ev := <-ab.events
+		if k := ev.key; k.Code == KeyRune && (k.Rune == rune(CtrlC) || k.Rune == rune(CtrlD)) {
+			return k, errQuit
+		}
+		if ev.result != nil {
+			ab.cancelRequest()
+			ab.cancelRequest = nil
+			ab.showResponse(ev.result.resp, ev.result.err)
+			continue
+		}
+		if !ev.resize {
+			return ev.key, ev.err
+		}
 
-	for i := 0; i < vPoint; i++ {
-		ab.t.Write([]byte(CursorDownESC))
-	}
+		w, h, err := term.GetSize(ab.fd)
+		if err != nil {
+			continue
+		}
+		ab.width, ab.height = w, h
+		ab.t.SetSize(w, h)
+		ab.layout = newScreenLayout(w, h, ab.showSidebar)
 
-	for i := 0; i < hPoint; i++ {
-		ab.t.Write([]byte(CursorRightESC))
+		fmt.Print(Clear)
+		ab.draw()
 	}
 }
 
-func (ab AlternateBuffer) _inputRequestField(buffer *[]byte) {
-	if ab.tabCount == 0 {
-		ab.rc.requestLine = string(*buffer)
-	}
-
-	if ab.tabCount == 1 {
-		ab.rc.requestHeaderHost = string(*buffer)
+// 入力されたRequestContentの変数を選んでいる環境で展開し、HTTPClientとRequestを作る。
+func (ab *AlternateBuffer) buildRequest() (*HTTPClient, *Request, error) {
+	rc, err := ab.rc.expand(ab.envVars())
+	if err != nil {
+		return nil, nil, err
 	}
+	return rc.build()
+}
 
-	if ab.tabCount == 2 {
-		ab.rc.requestHeaderContentType = string(*buffer)
-	}
+// clientでreqを送り始める。結果はab.eventsに届く。送っている間はEscでやめられる。
+func (ab *AlternateBuffer) startRequest(client *HTTPClient, req *Request) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ab.cancelRequest = cancel
+	ab.mode = modeResponse
+	ab.viewer = nil
 
-	if ab.tabCount == 3 {
-		ab.rc.requestBody = string(*buffer)
-	}
+	go func() {
+		resp, err := client.DoContext(ctx, req)
+		ab.events <- inputEvent{result: &requestResult{resp, err}}
+	}()
+	ab.drawResponse()
 }
 
-func (ab AlternateBuffer) RenderingRequestContent(esc uint8, buffer *[]byte) {
-	ab.MoveCursorRequestContent()
-	ab._renderingBuffer(esc, buffer)
+// 履歴とポートの決まり、接続のプールをclientに設定する。
+func (ab *AlternateBuffer) configureClient(client *HTTPClient) {
+	client.SetHistory(ab.history)
+	client.SetPortPolicy(ab.policy)
+	client.SetPool(ab.pool)
+}
 
-	if ab.tabCount == 0 {
-		ab.rc.requestLine = string(*buffer)
-		ab.RenderingRequestLine()
+// 画面全体を描画する。カーソルはフォーカスのある入力欄に置く。
+func (ab *AlternateBuffer) draw() {
+	l := ab.layout
+	if l.tooSmall {
+		ab._hiddenCursor()
+		msg := fmt.Sprintf("terminal too small (%dx%d): need at least %dx%d", ab.width, ab.height, minScreenWidth, l.minHeight)
+		fmt.Print(Clear, moveTo(1, 1), fitWidth(msg, ab.width))
+		return
 	}
 
-	if ab.tabCount == 1 {
-		ab.rc.requestHeaderHost = string(*buffer)
-		ab.RenderingRequestLine()
-		ab.RenderingRequestHeaderHost()
+	if l.hasSidebar {
+		fmt.Print(l.sidebar.Draw())
 	}
-
-	if ab.tabCount == 2 {
-		ab.rc.requestHeaderContentType = string(*buffer)
-		ab.RenderingRequestLine()
-		ab.RenderingRequestHeaderHost()
-		ab.RenderingRequestHeaderContentType()
+	l.request.Title = "HTTP REQUEST MESSAGE"
+	if ab.env != nil {
+		l.request.Title += " [" + ab.env.Name + "]"
 	}
-
-	if ab.tabCount == 3 {
-		ab.rc.requestBody = string(*buffer)
-		ab.RenderingRequestLine()
-		ab.RenderingRequestHeaderHost()
-		ab.RenderingRequestHeaderContentType()
-		ab.RenderingRequestBody()
+	fmt.Print(l.request.Draw())
+	fmt.Print(l.response.Draw())
+	fmt.Print(fillLines(l.buttons, nil))
+	for f := range focusCount {
+		ab.drawWidget(f)
 	}
+	ab.drawResponse()
 }
 
-func (ab *AlternateBuffer) _renderingBuffer(esc uint8, buffer *[]byte) {
-	if esc == Backspace || esc == CtrlH || esc == CtrlU {
-		ab.rw.remover(esc, buffer)
-		ab._inputRequestField(buffer)
-	} else {
-		ab.rw.adder(esc, buffer)
-		ab._inputRequestField(buffer)
+// レスポンスの表示と操作説明を描き直し、カーソルを置く。
+func (ab *AlternateBuffer) drawResponse() {
+	if ab.layout.tooSmall {
+		return
 	}
-}
-
-// TUIテキストを再レンダリングする
-func (ab AlternateBuffer) _reRenderingTUIText() {
-	fmt.Print(Clear)
-	fmt.Print(ab.tuiText)
-
-}
-
-func (ab *AlternateBuffer) ReadEnter() {
-	ab.moveCursorSendOrCancel()
-
-	r := make([]byte, 1)
-	for {
-		i, err := ab.rw.Read(r)
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
-		}
 
-		if i == 0 {
-			os.Exit(1)
+	area := ab.layout.response.Sections[0].Rect
+	if ab.cancelRequest != nil {
+		fmt.Print(fillLines(area, []string{" " + fitWidth("Sending the request...  (Esc: cancel)", area.Width-2)}))
+	} else if ab.preview && ab.mode == modeInput {
+		var lines []string
+		for _, l := range ab.previewLines(area.Width - 2) {
+			lines = append(lines, " "+fitWidth(l, area.Width-2))
 		}
-
-		esc := r[0]
-		if esc == Tab {
-			ab.scs = !ab.scs
-			ab.moveCursorSendOrCancel()
-		}
-
-		if esc == Enter {
-			break
+		fmt.Print(fillLines(area, lines))
+	} else if ab.mode == modeHistory {
+		var lines []string
+		for _, l := range ab.historyView.Render(area.Width-2, area.Height) {
+			lines = append(lines, " "+l)
 		}
+		fmt.Print(fillLines(area, lines))
+	} else if ab.viewer != nil {
+		fmt.Print(drawLines(area, ab.viewer.Render(area.Width, area.Height)))
+	} else {
+		fmt.Print(drawLines(area, []string{" " + fitWidth("Press SEND to see the response here.", area.Width-2)}))
 	}
+	ab.drawHelp()
+	ab.placeCursor()
 }
 
-func (ab *AlternateBuffer) ReadLine() {
-	bff := make([]byte, 1)
-	r := make([]byte, 1)
-
-	for {
-		i, err := ab.rw.Read(r)
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
-		}
-
-		esc := r[0]
-		if i == 0 || esc == Tab {
-			if esc == Tab {
-				ab.tabCount += 1
-				break
-			}
-		}
-
-		if esc == Enter {
-			continue
-		}
-
-		ab._reRenderingTUIText()
-		ab.RenderingRequestContent(esc, &bff)
+// 操作説明の行を描き直す。入力中のpromptか、操作の結果のメッセージがあればそれを出す。
+func (ab *AlternateBuffer) drawHelp() {
+	l := ab.layout
+	if l.tooSmall {
+		return
 	}
-}
-
-func (rw TerminalReadWriter) remover(esc uint8, buffer *[]byte) {
-	l := len(*buffer)
-
-	if l == 0 {
+	if ab.prompt != nil {
+		ab.drawPrompt()
 		return
 	}
 
-	if esc == Backspace || esc == CtrlH {
-		rw._remover(buffer)
-		return
+	text := ab.helpText()
+	if ab.message != "" {
+		text = ab.message
 	}
+	fmt.Print(moveTo(l.help.Row, l.help.Col) + centering(fitWidth(text, l.help.Width), l.help.Width))
+}
 
-	if esc == CtrlU {
-		for i := 0; i < l; i++ {
-			rw._remover(buffer)
-		}
-		return
+func (ab *AlternateBuffer) helpText() string {
+	if ab.cancelRequest != nil {
+		return "Esc: cancel the request  ^C: quit"
+	}
+	switch ab.mode {
+	case modeResponse:
+		return ab.viewer.help()
+	case modeHistory:
+		return "↑↓/PgUp/PgDn/Home/End: select  Enter: replay  e: copy to editor  h: host  s: status  x: clear filter  q: close"
+	}
+	switch ab.focus {
+	case focusCollection:
+		return "↑↓: select  Enter: load  s: save as  c: duplicate  r: rename  d: delete  ^B: hide"
+	case focusSend, focusCancel:
+		return "Tab/S-Tab: focus  ←→: SEND/CANCEL  Enter: select  ^C: quit"
+	case focusHeader:
+		return "Tab/S-Tab: focus  ↑↓: row  Enter: name/value  ^A: add  ^X: delete  ^T: on/off  ^P/^N: move up/down"
+	case focusBody:
+		return "Tab/S-Tab: focus  Enter: new line  ←↑↓→/Home/End/PgUp/PgDn: move  BS/Del/^U: delete  ^C: quit"
 	}
+	return "Tab/S-Tab: focus  ←→/Home/End: move  BS/Del/^U: delete  ^S: save  ^E: env  ^R: preview  ^Y: history  ^C: quit"
 }
 
-func (rw TerminalReadWriter) _remover(buffer *[]byte) {
-	*buffer = (*buffer)[:len(*buffer)-1]
+func (ab AlternateBuffer) _visibleCursor() {
+	fmt.Print("\x1b[?25h")
 }
 
-func (rw TerminalReadWriter) adder(esc uint8, buffer *[]byte) {
-	*buffer = append(*buffer, esc)
+func (ab AlternateBuffer) _hiddenCursor() {
+	fmt.Print("\x1b[?25l")
 }
 
-func (ab AlternateBuffer) Restore() {
-	err := term.Restore(ab.fd, ab.OldState)
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+// 入力欄に収まらない値は末尾だけを表示する。カーソルの分の1文字は空けておく。
+func fieldTail(s string, width int) string {
+	cs := clusters([]rune(sanitize(s)))
+	start, w := len(cs), 0
+	for start > 0 && w+clusterWidth(cs[start-1]) < width {
+		start--
+		w += clusterWidth(cs[start])
 	}
+	return string(slices.Concat(cs[start:]...))
+}
+
+// 1始まりのrow行目、col列目にカーソルを移動する。
+func (ab AlternateBuffer) moveCursor(row, col int) {
+	ab.t.Write([]byte(moveTo(row, col)))
+}
 
+// 画面と端末のモードを元に戻す。
+func (ab AlternateBuffer) Restore() error {
+	os.Stdout.Write([]byte(DisableBracketedPaste))
 	os.Stdout.Write([]byte(ExitESC))
+	return term.Restore(ab.fd, ab.OldState)
 }
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// 端末で2桁を使う文字(East Asian WideとFullwidth、絵文字)の範囲。
+var wideRanges = [][2]rune{
+	{0x1100, 0x115f},
+	{0x231a, 0x231b},
+	{0x2329, 0x232a},
+	{0x23e9, 0x23ec},
+	{0x23f0, 0x23f0},
+	{0x23f3, 0x23f3},
+	{0x25fd, 0x25fe},
+	{0x2614, 0x2615},
+	{0x2648, 0x2653},
+	{0x267f, 0x267f},
+	{0x2693, 0x2693},
+	{0x26a1, 0x26a1},
+	{0x26aa, 0x26ab},
+	{0x26bd, 0x26be},
+	{0x26c4, 0x26c5},
+	{0x26ce, 0x26ce},
+	{0x26d4, 0x26d4},
+	{0x26ea, 0x26ea},
+	{0x26f2, 0x26f3},
+	{0x26f5, 0x26f5},
+	{0x26fa, 0x26fa},
+	{0x26fd, 0x26fd},
+	{0x2705, 0x2705},
+	{0x270a, 0x270b},
+	{0x2728, 0x2728},
+	{0x274c, 0x274c},
+	{0x274e, 0x274e},
+	{0x2753, 0x2755},
+	{0x2757, 0x2757},
+	{0x2795, 0x2797},
+	{0x27b0, 0x27b0},
+	{0x27bf, 0x27bf},
+	{0x2b1b, 0x2b1c},
+	{0x2b50, 0x2b50},
+	{0x2b55, 0x2b55},
+	{0x2e80, 0x303e},
+	{0x3041, 0x33ff},
+	{0x3400, 0x4dbf},
+	{0x4e00, 0x9fff},
+	{0xa000, 0xa4cf},
+	{0xa960, 0xa97f},
+	{0xac00, 0xd7a3},
+	{0xf900, 0xfaff},
+	{0xfe10, 0xfe19},
+	{0xfe30, 0xfe6f},
+	{0xff00, 0xff60},
+	{0xffe0, 0xffe6},
+	{0x16fe0, 0x16fe4},
+	{0x17000, 0x18cff},
+	{0x1b000, 0x1b2ff},
+	{0x1f004, 0x1f004},
+	{0x1f0cf, 0x1f0cf},
+	{0x1f18e, 0x1f18e},
+	{0x1f191, 0x1f19a},
+	{0x1f200, 0x1f202},
+	{0x1f210, 0x1f23b},
+	{0x1f240, 0x1f248},
+	{0x1f250, 0x1f251},
+	{0x1f260, 0x1f265},
+	{0x1f300, 0x1f64f},
+	{0x1f680, 0x1f6ff},
+	{0x1f7e0, 0x1f7eb},
+	{0x1f90c, 0x1f9ff},
+	{0x1fa70, 0x1faff},
+	{0x20000, 0x2fffd},
+	{0x30000, 0x3fffd},
+}
+
+// 1文字の表示幅。結合文字などの幅を持たない文字は0、全角の文字は2になる。
+// 制御文字はsanitizeで取り除く(タブは空白にする)ので、それに合わせる。
+func runeWidth(r rune) int {
+	switch {
+	case r == '\t':
+		return 1
+	case r < ' ' || r == 0x7f:
+		return 0
+	case r < 0x7f:
+		return 1
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf), 0x1160 <= r && r <= 0x11ff:
+		return 0
+	}
+
+	_, wide := slices.BinarySearchFunc(wideRanges, r, func(rng [2]rune, r rune) int {
+		switch {
+		case rng[1] < r:
+			return -1
+		case r < rng[0]:
+			return 1
+		}
+		return 0
+	})
+	if wide {
+		return 2
+	}
+	return 1
+}
+
+func isRegionalIndicator(r rune) bool {
+	return 0x1f1e6 <= r && r <= 0x1f1ff
+}
+
+// 直前の文字とつなげて1つの書記素クラスタにする文字か。
+func isExtender(r rune) bool {
+	return unicode.Is(unicode.M, r) ||
+		r == 0x200d || // ZWJ
+		0x1f3fb <= r && r <= 0x1f3ff || // 肌の色の修飾子
+		0xe0020 <= r && r <= 0xe007f || // タグ
+		0x1160 <= r && r <= 0x11ff // ハングルの中声、終声
+}
+
+// rsの先頭の書記素クラスタのrune数。UAX #29を簡略化し、結合文字、ZWJでつないだ絵文字、
+// 国旗(Regional Indicatorの組)を1つのクラスタにまとめる。
+func clusterLen(rs []rune) int {
+	if len(rs) == 0 {
+		return 0
+	}
+	if isRegionalIndicator(rs[0]) && len(rs) > 1 && isRegionalIndicator(rs[1]) {
+		return 2
+	}
+
+	n := 1
+	for n < len(rs) {
+		switch {
+		case rs[n-1] == 0x200d:
+			n++
+		case isExtender(rs[n]):
+			n++
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+// 書記素クラスタの表示幅。異体字セレクタ(VS16)で絵文字として表示する文字と国旗は2になる。
+func clusterWidth(c []rune) int {
+	if len(c) == 0 {
+		return 0
+	}
+	if isRegionalIndicator(c[0]) || slices.Contains(c, 0xfe0f) {
+		return 2
+	}
+	return runeWidth(c[0])
+}
+
+// rsを書記素クラスタに分ける。
+func clusters(rs []rune) [][]rune {
+	var cs [][]rune
+	for len(rs) > 0 {
+		n := clusterLen(rs)
+		cs = append(cs, rs[:n])
+		rs = rs[n:]
+	}
+	return cs
+}
+
+func runesWidth(rs []rune) int {
+	w := 0
+	for _, c := range clusters(rs) {
+		w += clusterWidth(c)
+	}
+	return w
+}
+
+func stringWidth(s string) int {
+	return runesWidth([]rune(s))
+}
+
+// rsのi文字目(rune)より前にある書記素クラスタの境界。
+func prevBoundary(rs []rune, i int) int {
+	prev := 0
+	for j := 0; j < i; {
+		prev = j
+		j += clusterLen(rs[j:])
+	}
+	return prev
+}
+
+// rsのi文字目(rune)より後にある書記素クラスタの境界。
+func nextBoundary(rs []rune, i int) int {
+	return min(len(rs), i+clusterLen(rs[i:]))
+}
+
+// 最後の書記素クラスタを取り除く。
+func trimLastCluster(s string) string {
+	rs := []rune(s)
+	return string(rs[:prevBoundary(rs, len(rs))])
+}
+
+// 表示上のfrom桁目からwidth桁分を切り出す。
+// 境界をまたいで半分だけ見える全角文字は空白にする。
+func sliceColumns(rs []rune, from, width int) string {
+	var b strings.Builder
+	x := 0
+	for _, c := range clusters(rs) {
+		w := clusterWidth(c)
+		switch {
+		case x+w <= from:
+		case x >= from+width:
+			return b.String()
+		case x < from || x+w > from+width:
+			b.WriteString(strings.Repeat(" ", min(x+w, from+width)-max(x, from)))
+		default:
+			b.WriteString(string(c))
+		}
+		x += w
+	}
+	return b.String()
+}
+
+// 表示上のx桁目にある書記素クラスタの先頭の位置(rune)。xが行の幅を超えていれば行末を返す。
+func indexAtColumn(rs []rune, x int) int {
+	i, w := 0, 0
+	for i < len(rs) {
+		n := clusterLen(rs[i:])
+		cw := clusterWidth(rs[i : i+n])
+		if w+cw > x {
+			break
+		}
+		i += n
+		w += cw
+	}
+	return i
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+)
+
+// テスト用のエンドポイントを登録したrouterを作る。
+func newRouter() *Router {
+	router := NewRouter()
+	router.Handle("GET", "/", handleRoot)
+	router.Handle("POST", "/echo", handleEcho)
+	router.Handle("GET", "/hello/{name}", handleHello)
+	router.Handle("GET", "/debug/", handleDebug)
+	return router
+}
+
+func handleRoot(w *ResponseWriter, req *Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("recieved your msg."))
+}
+
+// 受け取ったbodyをそのまま返す。
+func handleEcho(w *ResponseWriter, req *Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		writeError(w, readErrorStatus(err))
+		return
+	}
+
+	contentType := req.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+}
+
+func handleHello(w *ResponseWriter, req *Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(w, "hello, %s!", req.PathValue("name"))
+}
+
+// 受け取ったリクエストの内容を表示する。
+func handleDebug(w *ResponseWriter, req *Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(w, "%s %s %s\n", req.Method, req.Target, req.Proto)
+	for _, k := range slices.Sorted(maps.Keys(req.Header)) {
+		for _, v := range req.Header[k] {
+			fmt.Fprintf(w, "%s: %s\n", k, v)
+		}
+	}
+}
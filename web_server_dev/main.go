@@ -2,9 +2,21 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
+	"strings"
+	"time"
+)
+
+const maxRequestsPerConn = 100
+
+// テストで短くできるように変数にしておく。
+var (
+	idleTimeout    = 30 * time.Second // 次のリクエストが届き始めるまで待つ時間
+	requestTimeout = 10 * time.Second // 届き始めたリクエストを読み終えるまでの時間
 )
 
 // TCPServer
@@ -17,6 +29,8 @@ func main() {
 
 	defer listener.Close()
 
+	router := newRouter()
+
 	for {
 		conn, err := listener.Accept()
 
@@ -24,23 +38,107 @@ func main() {
 			fmt.Println("Error accepting connetion: ", err)
 			continue
 		}
-		go handleConnection(conn)
+		go handleConnection(conn, router)
 	}
 }
 
-func handleConnection(conn net.Conn) {
+// 1つの接続で複数のリクエストを順番に処理する(keep-alive)。
+// パイプライン化されたリクエストにも、受け取った順にレスポンスを返す。
+func handleConnection(conn net.Conn, router *Router) {
 	// connをflowの最後に必ずClose()させる。
 	defer conn.Close()
 
 	reader := bufio.NewReader(conn)
-	status, err := reader.ReadString('\n')
-	if err != nil {
-		fmt.Println("Error: ", err)
-		response := "HTTP/1.1 400 Bad Request\r\n" + "Content-type: text/plain\r\n" + "\r\n" + "For now, let's just say 400."
-		conn.Write([]byte(response))
-	} else {
-		fmt.Println("status: ", status)
-		response := "HTTP/1.1 200 OK\r\n" + "Content-type: text/plain\r\n" + "\r\n" + "recieved your msg."
-		conn.Write([]byte(response))
+	writer := bufio.NewWriter(conn)
+
+	for n := 1; ; n++ {
+		// 何も送らずに閉じられた接続やidle状態のままの接続には応答しない。
+		conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		if _, err := reader.Peek(1); err != nil {
+			return
+		}
+
+		conn.SetReadDeadline(time.Now().Add(requestTimeout))
+		req, err := readRequest(reader)
+		if err != nil {
+			fmt.Println("Error: ", err)
+			statusCode := readErrorStatus(err)
+			header := Header{"Content-Type": {"text/plain"}, "Connection": {"close"}}
+			writeResponse(writer, statusCode, header, statusText(statusCode))
+			writer.Flush()
+			return
+		}
+
+		fmt.Println("request: ", req.Method, req.Target, req.Proto)
+
+		w := NewResponseWriter()
+		router.ServeHTTP(w, req)
+
+		// ハンドラーが読まなかったbodyを読み捨てて、次のリクエストの先頭まで進める。
+		keepAlive := n < maxRequestsPerConn && shouldKeepAlive(req) && !hasToken(w.Header().Values("Connection"), "close")
+		if _, err := io.Copy(io.Discard, req.Body); err != nil {
+			keepAlive = false
+		}
+
+		if keepAlive {
+			if req.ProtoMinor == 0 {
+				w.Header().Set("Connection", "keep-alive")
+			}
+			w.Header().Set("Keep-Alive", fmt.Sprintf("timeout=%d, max=%d", int(idleTimeout.Seconds()), maxRequestsPerConn-n))
+		} else {
+			w.Header().Set("Connection", "close")
+		}
+
+		if err := w.flush(writer, req); err != nil {
+			fmt.Println("Error: ", err)
+			return
+		}
+
+		// パイプラインで次のリクエストが届いていれば、まとめて送る。
+		if reader.Buffered() == 0 || !keepAlive {
+			if err := writer.Flush(); err != nil {
+				fmt.Println("Error: ", err)
+				return
+			}
+		}
+
+		if !keepAlive {
+			return
+		}
+	}
+}
+
+// リクエストを読めなかったときに返すステータスコード。途中で届かなくなったときは408にする。
+func readErrorStatus(err error) int {
+	var reqErr *requestError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &reqErr):
+		return reqErr.statusCode
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return 408
+	default:
+		return 400
+	}
+}
+
+// HTTP/1.1は"Connection: close"がなければ、HTTP/1.0は"Connection: keep-alive"があれば接続を維持する。
+func shouldKeepAlive(req *Request) bool {
+	connection := req.Header.Values("Connection")
+	if req.ProtoMinor == 0 {
+		return hasToken(connection, "keep-alive")
+	}
+	return !hasToken(connection, "close")
+}
+
+// カンマ区切りのヘッダーの値にtokenが含まれているか(大文字小文字は区別しない)。
+func hasToken(values []string, token string) bool {
+	for _, v := range values {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
 	}
+	return false
 }
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// テスト用のレスポンス。
+type testResponse struct {
+	statusCode int
+	header     Header
+	body       string
+}
+
+// net.Pipeの片側でhandleConnectionを動かし、もう片側を返す。
+func startConnection(t *testing.T) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	client, server := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		handleConnection(server, newRouter())
+		close(done)
+	}()
+	t.Cleanup(func() {
+		client.Close()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Error("handleConnection did not return")
+		}
+	})
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	return client, bufio.NewReader(client)
+}
+
+// msgを送る。net.Pipeは読まれるまで書き込みが終わらないので、別のgoroutineで送る。
+func send(conn net.Conn, msg string) {
+	go io.WriteString(conn, msg)
+}
+
+func readTestResponse(t *testing.T, r *bufio.Reader) *testResponse {
+	t.Helper()
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("can not read status line: %v", err)
+	}
+	parts := strings.SplitN(strings.TrimRight(line, "\r\n"), " ", 3)
+	statusCode, err := strconv.Atoi(parts[1])
+	if err != nil {
+		t.Fatalf("invalid status line %q", line)
+	}
+
+	resp := &testResponse{statusCode: statusCode, header: Header{}}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("can not read header: %v", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		name, value, _ := strings.Cut(line, ":")
+		resp.header.Add(name, strings.TrimSpace(value))
+	}
+
+	n, err := strconv.Atoi(resp.header.Get("Content-Length"))
+	if err != nil {
+		t.Fatalf("invalid Content-Length %q", resp.header.Get("Content-Length"))
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		t.Fatalf("can not read body: %v", err)
+	}
+	resp.body = string(body)
+	return resp
+}
+
+// サーバーが接続を閉じたことを確かめる。
+func expectClosed(t *testing.T, r *bufio.Reader) {
+	t.Helper()
+	if b, err := r.ReadByte(); err != io.EOF {
+		t.Errorf("read %q, %v, want the connection to be closed", b, err)
+	}
+}
+
+func TestHandleConnectionKeepAlive(t *testing.T) {
+	tests := []struct {
+		name       string
+		req        string
+		connection string
+		keepAlive  bool
+	}{
+		{"HTTP/1.1", "GET / HTTP/1.1\r\nHost: a\r\n\r\n", "", true},
+		{"HTTP/1.1 Connection: close", "GET / HTTP/1.1\r\nHost: a\r\nConnection: close\r\n\r\n", "close", false},
+		{"HTTP/1.1 Connection tokens", "GET / HTTP/1.1\r\nHost: a\r\nConnection: foo, Close\r\n\r\n", "close", false},
+		{"HTTP/1.0", "GET / HTTP/1.0\r\n\r\n", "close", false},
+		{"HTTP/1.0 keep-alive", "GET / HTTP/1.0\r\nConnection: keep-alive\r\n\r\n", "keep-alive", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, r := startConnection(t)
+			send(conn, tt.req)
+			resp := readTestResponse(t, r)
+			if resp.statusCode != 200 {
+				t.Errorf("status code = %d, want 200", resp.statusCode)
+			}
+			if got := resp.header.Get("Connection"); got != tt.connection {
+				t.Errorf("Connection = %q, want %q", got, tt.connection)
+			}
+
+			if !tt.keepAlive {
+				if got := resp.header.Get("Keep-Alive"); got != "" {
+					t.Errorf("Keep-Alive = %q, want none", got)
+				}
+				expectClosed(t, r)
+				return
+			}
+
+			want := fmt.Sprintf("timeout=%d, max=%d", int(idleTimeout.Seconds()), maxRequestsPerConn-1)
+			if got := resp.header.Get("Keep-Alive"); got != want {
+				t.Errorf("Keep-Alive = %q, want %q", got, want)
+			}
+			// 同じ接続で次のリクエストを受け付ける。
+			send(conn, tt.req)
+			if resp := readTestResponse(t, r); resp.statusCode != 200 {
+				t.Errorf("second status code = %d, want 200", resp.statusCode)
+			}
+		})
+	}
+}
+
+func TestHandleConnectionMaxRequests(t *testing.T) {
+	conn, r := startConnection(t)
+	for n := 1; n <= maxRequestsPerConn; n++ {
+		send(conn, "GET / HTTP/1.1\r\nHost: a\r\n\r\n")
+		resp := readTestResponse(t, r)
+
+		if n < maxRequestsPerConn {
+			want := fmt.Sprintf("timeout=%d, max=%d", int(idleTimeout.Seconds()), maxRequestsPerConn-n)
+			if got := resp.header.Get("Keep-Alive"); got != want {
+				t.Fatalf("request %d: Keep-Alive = %q, want %q", n, got, want)
+			}
+			continue
+		}
+		// 最後のリクエストの後は接続を閉じる。
+		if got := resp.header.Get("Connection"); got != "close" {
+			t.Errorf("request %d: Connection = %q, want close", n, got)
+		}
+	}
+	expectClosed(t, r)
+}
+
+func TestHandleConnectionPipeline(t *testing.T) {
+	conn, r := startConnection(t)
+	send(conn, "GET /hello/a HTTP/1.1\r\nHost: a\r\n\r\n"+
+		"POST /echo HTTP/1.1\r\nHost: a\r\nContent-Length: 1\r\n\r\nb"+
+		"GET /hello/c HTTP/1.1\r\nHost: a\r\nConnection: close\r\n\r\n")
+
+	for _, want := range []string{"hello, a!", "b", "hello, c!"} {
+		if resp := readTestResponse(t, r); resp.body != want {
+			t.Errorf("body = %q, want %q", resp.body, want)
+		}
+	}
+	expectClosed(t, r)
+}
+
+func TestHandleConnectionDrainBody(t *testing.T) {
+	conn, r := startConnection(t)
+	// GET /のハンドラーはbodyを読まない。
+	send(conn, "GET / HTTP/1.1\r\nHost: a\r\nContent-Length: 21\r\n\r\nGET /hello/x HTTP/1.1")
+	if resp := readTestResponse(t, r); resp.statusCode != 200 {
+		t.Errorf("status code = %d, want 200", resp.statusCode)
+	}
+
+	send(conn, "GET /hello/y HTTP/1.1\r\nHost: a\r\n\r\n")
+	if resp := readTestResponse(t, r); resp.body != "hello, y!" {
+		t.Errorf("body = %q, want %q", resp.body, "hello, y!")
+	}
+}
+
+func TestHandleConnectionTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+	}{
+		{"in the request line", "GET / HT"},
+		{"in the header", "GET / HTTP/1.1\r\nHost: a\r\n"},
+		{"in the body", "POST /echo HTTP/1.1\r\nHost: a\r\nContent-Length: 10\r\n\r\nabc"},
+	}
+
+	setTimeouts(t, time.Second, 50*time.Millisecond)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, r := startConnection(t)
+			send(conn, tt.msg)
+			resp := readTestResponse(t, r)
+			if resp.statusCode != 408 {
+				t.Errorf("status code = %d, want 408", resp.statusCode)
+			}
+			if got := resp.header.Get("Connection"); got != "close" {
+				t.Errorf("Connection = %q, want close", got)
+			}
+			expectClosed(t, r)
+		})
+	}
+}
+
+func TestHandleConnectionIdle(t *testing.T) {
+	setTimeouts(t, 50*time.Millisecond, time.Second)
+	conn, r := startConnection(t)
+	send(conn, "GET / HTTP/1.1\r\nHost: a\r\n\r\n")
+	readTestResponse(t, r)
+
+	// 次のリクエストが届かなければ、何も返さずに閉じる。
+	expectClosed(t, r)
+}
+
+func setTimeouts(t *testing.T, idle, request time.Duration) {
+	t.Helper()
+	oldIdle, oldRequest := idleTimeout, requestTimeout
+	idleTimeout, requestTimeout = idle, request
+	t.Cleanup(func() {
+		idleTimeout, requestTimeout = oldIdle, oldRequest
+	})
+}
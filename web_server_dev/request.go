@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxLineLength  = 8192
+	maxHeaderCount = 100
+)
+
+// HTTPリクエストヘッダー。キーは正規化された形(e.g. Content-Length)で保持する。
+type Header map[string][]string
+
+// 値を追加する。同じ名前のヘッダーが複数あれば全て保持する。
+func (h Header) Add(key, value string) {
+	key = canonicalHeaderKey(key)
+	h[key] = append(h[key], value)
+}
+
+// 既存の値を置き換える。
+func (h Header) Set(key, value string) {
+	h[canonicalHeaderKey(key)] = []string{value}
+}
+
+// 最初の値を返す。なければ空文字。
+func (h Header) Get(key string) string {
+	v := h[canonicalHeaderKey(key)]
+	if len(v) == 0 {
+		return ""
+	}
+	return v[0]
+}
+
+// 全ての値を返す。
+func (h Header) Values(key string) []string {
+	return h[canonicalHeaderKey(key)]
+}
+
+func (h Header) Del(key string) {
+	delete(h, canonicalHeaderKey(key))
+}
+
+// ヘッダー名を先頭と'-'の直後だけ大文字にした形にそろえる。
+func canonicalHeaderKey(key string) string {
+	b := []byte(strings.ToLower(key))
+	upper := true
+	for i, c := range b {
+		if upper && 'a' <= c && c <= 'z' {
+			b[i] = c - ('a' - 'A')
+		}
+		upper = c == '-'
+	}
+	return string(b)
+}
+
+type Request struct {
+	Method        string
+	Target        string // request-target(e.g. /index.html?q=1)
+	Path          string
+	RawQuery      string
+	Proto         string // e.g. HTTP/1.1
+	ProtoMajor    int
+	ProtoMinor    int
+	Header        Header
+	ContentLength int64
+	Body          io.Reader
+
+	params map[string]string // routerがpatternの{param}から取り出した値
+}
+
+// patternの{name}に対応するpathの値を返す。
+func (req *Request) PathValue(name string) string {
+	return req.params[name]
+}
+
+// リクエストの解析に失敗したときのエラー。返すべきステータスコードを持つ。
+type requestError struct {
+	statusCode int
+	msg        string
+}
+
+func (e *requestError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.statusCode, statusText(e.statusCode), e.msg)
+}
+
+func badRequest(format string, a ...any) error {
+	return &requestError{statusCode: 400, msg: fmt.Sprintf(format, a...)}
+}
+
+// readerからHTTPリクエストを1つ読みとる。
+// 何も読まないうちに接続が閉じられた場合はio.EOFを返す。
+func readRequest(reader *bufio.Reader) (*Request, error) {
+	line, err := readLine(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &Request{Header: Header{}}
+	if err := req.parseRequestLine(line); err != nil {
+		return nil, err
+	}
+
+	if err := req.readHeader(reader); err != nil {
+		return nil, err
+	}
+
+	if err := req.setBody(reader); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// CRLF(もしくはLF)までの1行を読み、行末を取り除いて返す。
+func readLine(reader *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		b, err := reader.ReadSlice('\n')
+		line = append(line, b...)
+		if len(line) > maxLineLength {
+			return "", badRequest("line too long")
+		}
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			if err == io.EOF && len(line) > 0 {
+				return "", io.ErrUnexpectedEOF
+			}
+			return "", err
+		}
+		break
+	}
+
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	return string(line), nil
+}
+
+// request-line = method SP request-target SP HTTP-version
+func (req *Request) parseRequestLine(line string) error {
+	parts := strings.Split(line, " ")
+	if len(parts) != 3 {
+		return badRequest("malformed request line %q", line)
+	}
+
+	req.Method, req.Target, req.Proto = parts[0], parts[1], parts[2]
+
+	if !isToken(req.Method) {
+		return badRequest("invalid method %q", req.Method)
+	}
+
+	if err := req.parseTarget(); err != nil {
+		return err
+	}
+
+	major, minor, ok := parseHTTPVersion(req.Proto)
+	if !ok {
+		return badRequest("invalid HTTP version %q", req.Proto)
+	}
+	if major != 1 {
+		return &requestError{statusCode: 505, msg: fmt.Sprintf("unsupported HTTP version %q", req.Proto)}
+	}
+	req.ProtoMajor, req.ProtoMinor = major, minor
+
+	return nil
+}
+
+// request-targetからpathとqueryを取り出す。
+func (req *Request) parseTarget() error {
+	t := req.Target
+	if t == "" {
+		return badRequest("empty request target")
+	}
+	for i := 0; i < len(t); i++ {
+		if t[i] <= ' ' || t[i] == 0x7f {
+			return badRequest("invalid request target %q", t)
+		}
+	}
+
+	switch {
+	case t == "*":
+		if req.Method != "OPTIONS" {
+			return badRequest("asterisk-form is only allowed for OPTIONS")
+		}
+		req.Path = t
+		return nil
+	case req.Method == "CONNECT":
+		// authority-form(host:port)
+		req.Path = t
+		return nil
+	case strings.HasPrefix(t, "http://") || strings.HasPrefix(t, "https://"):
+		// absolute-form。authorityの部分は捨ててpathだけを使う。
+		_, rest, _ := strings.Cut(t, "://")
+		i := strings.IndexAny(rest, "/?")
+		if i < 0 {
+			t = "/"
+		} else {
+			t = rest[i:]
+		}
+		if strings.HasPrefix(t, "?") {
+			t = "/" + t
+		}
+	case !strings.HasPrefix(t, "/"):
+		return badRequest("invalid request target %q", t)
+	}
+
+	t, _, _ = strings.Cut(t, "#")
+	req.Path, req.RawQuery, _ = strings.Cut(t, "?")
+	return nil
+}
+
+// "HTTP/1.1"のような文字列からバージョン番号を取り出す。
+func parseHTTPVersion(v string) (int, int, bool) {
+	if len(v) != len("HTTP/1.1") || !strings.HasPrefix(v, "HTTP/") || v[6] != '.' {
+		return 0, 0, false
+	}
+
+	major, minor := v[5], v[7]
+	if major < '0' || '9' < major || minor < '0' || '9' < minor {
+		return 0, 0, false
+	}
+
+	return int(major - '0'), int(minor - '0'), true
+}
+
+// 空行までのヘッダーフィールドを読む。
+func (req *Request) readHeader(reader *bufio.Reader) error {
+	for n := 0; ; n++ {
+		line, err := readLine(reader)
+		if err != nil {
+			if err == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+
+		if line == "" {
+			break
+		}
+
+		if n >= maxHeaderCount {
+			return &requestError{statusCode: 431, msg: "too many header fields"}
+		}
+
+		// obs-foldは受け付けない。
+		if line[0] == ' ' || line[0] == '\t' {
+			return badRequest("obsolete line folding in header")
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || !isToken(name) {
+			return badRequest("malformed header field %q", line)
+		}
+
+		req.Header.Add(name, strings.Trim(value, " \t"))
+	}
+
+	if req.ProtoMinor >= 1 && len(req.Header.Values("Host")) != 1 {
+		return badRequest("HTTP/1.1 request must have exactly one Host header")
+	}
+
+	return nil
+}
+
+// Content-Lengthを見てBodyを用意する。
+func (req *Request) setBody(reader *bufio.Reader) error {
+	if len(req.Header.Values("Transfer-Encoding")) > 0 {
+		if len(req.Header.Values("Content-Length")) > 0 {
+			return badRequest("both Transfer-Encoding and Content-Length are present")
+		}
+		return &requestError{statusCode: 501, msg: "Transfer-Encoding is not supported"}
+	}
+
+	var length int64
+	values := req.Header.Values("Content-Length")
+	for i, v := range values {
+		n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil || n < 0 {
+			return badRequest("invalid Content-Length %q", v)
+		}
+		if i > 0 && n != length {
+			return badRequest("conflicting Content-Length values")
+		}
+		length = n
+	}
+
+	req.ContentLength = length
+	req.Body = io.LimitReader(reader, length)
+	return nil
+}
+
+// RFC 9110のtokenかどうか。
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		msg      string
+		method   string
+		path     string
+		rawQuery string
+		minor    int
+		header   Header
+		body     string
+	}{
+		{
+			name:   "simple GET",
+			msg:    "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n",
+			method: "GET",
+			path:   "/",
+			minor:  1,
+			header: Header{"Host": {"localhost"}},
+		},
+		{
+			name:     "query and fragment",
+			msg:      "GET /search?q=go&n=1#top HTTP/1.1\r\nHost: a\r\n\r\n",
+			method:   "GET",
+			path:     "/search",
+			rawQuery: "q=go&n=1",
+			minor:    1,
+			header:   Header{"Host": {"a"}},
+		},
+		{
+			name:     "absolute-form",
+			msg:      "GET http://example.com:8080/a/b?x=1 HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			method:   "GET",
+			path:     "/a/b",
+			rawQuery: "x=1",
+			minor:    1,
+			header:   Header{"Host": {"example.com"}},
+		},
+		{
+			name:     "absolute-form without path",
+			msg:      "GET http://example.com?x=1 HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			method:   "GET",
+			path:     "/",
+			rawQuery: "x=1",
+			minor:    1,
+			header:   Header{"Host": {"example.com"}},
+		},
+		{
+			name:   "asterisk-form",
+			msg:    "OPTIONS * HTTP/1.1\r\nHost: a\r\n\r\n",
+			method: "OPTIONS",
+			path:   "*",
+			minor:  1,
+			header: Header{"Host": {"a"}},
+		},
+		{
+			name:   "authority-form",
+			msg:    "CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\n",
+			method: "CONNECT",
+			path:   "example.com:443",
+			minor:  1,
+			header: Header{"Host": {"example.com:443"}},
+		},
+		{
+			name:   "HTTP/1.0 without Host",
+			msg:    "GET /old HTTP/1.0\r\n\r\n",
+			method: "GET",
+			path:   "/old",
+			header: Header{},
+		},
+		{
+			name:   "header names are case-insensitive and values are trimmed",
+			msg:    "GET / HTTP/1.1\r\nhost: a\r\nX-MULTI:  1 \r\nx-multi:\t2\r\nEmpty:\r\n\r\n",
+			method: "GET",
+			path:   "/",
+			minor:  1,
+			header: Header{"Host": {"a"}, "X-Multi": {"1", "2"}, "Empty": {""}},
+		},
+		{
+			name:   "LF line endings",
+			msg:    "GET / HTTP/1.1\nHost: a\n\n",
+			method: "GET",
+			path:   "/",
+			minor:  1,
+			header: Header{"Host": {"a"}},
+		},
+		{
+			name:   "body by Content-Length",
+			msg:    "POST /users HTTP/1.1\r\nHost: a\r\nContent-Length: 5\r\n\r\nhelloGET / HTTP/1.1",
+			method: "POST",
+			path:   "/users",
+			minor:  1,
+			header: Header{"Host": {"a"}, "Content-Length": {"5"}},
+			body:   "hello",
+		},
+		{
+			name:   "repeated equal Content-Length",
+			msg:    "PUT /a HTTP/1.1\r\nHost: a\r\nContent-Length: 2\r\nContent-Length: 2\r\n\r\nok",
+			method: "PUT",
+			path:   "/a",
+			minor:  1,
+			header: Header{"Host": {"a"}, "Content-Length": {"2", "2"}},
+			body:   "ok",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := readRequest(bufio.NewReader(strings.NewReader(tt.msg)))
+			if err != nil {
+				t.Fatalf("readRequest: %v", err)
+			}
+			if req.Method != tt.method || req.Path != tt.path || req.RawQuery != tt.rawQuery {
+				t.Errorf("got %s %s ? %s, want %s %s ? %s", req.Method, req.Path, req.RawQuery, tt.method, tt.path, tt.rawQuery)
+			}
+			if req.ProtoMajor != 1 || req.ProtoMinor != tt.minor {
+				t.Errorf("version = %d.%d, want 1.%d", req.ProtoMajor, req.ProtoMinor, tt.minor)
+			}
+			if !maps.EqualFunc(req.Header, tt.header, slices.Equal) {
+				t.Errorf("header = %v, want %v", req.Header, tt.header)
+			}
+			body, err := io.ReadAll(req.Body)
+			if err != nil || string(body) != tt.body {
+				t.Errorf("body = %q, %v, want %q", body, err, tt.body)
+			}
+		})
+	}
+}
+
+func TestReadRequestError(t *testing.T) {
+	tests := []struct {
+		name       string
+		msg        string
+		statusCode int
+	}{
+		{"two parts", "GET /\r\n\r\n", 400},
+		{"four parts", "GET / HTTP/1.1 extra\r\nHost: a\r\n\r\n", 400},
+		{"double space", "GET  / HTTP/1.1\r\nHost: a\r\n\r\n", 400},
+		{"empty method", " / HTTP/1.1\r\nHost: a\r\n\r\n", 400},
+		{"method with separator", "GE(T / HTTP/1.1\r\nHost: a\r\n\r\n", 400},
+		{"relative target", "GET index.html HTTP/1.1\r\nHost: a\r\n\r\n", 400},
+		{"control character in target", "GET /a\x01b HTTP/1.1\r\nHost: a\r\n\r\n", 400},
+		{"asterisk-form with GET", "GET * HTTP/1.1\r\nHost: a\r\n\r\n", 400},
+		{"lowercase version", "GET / http/1.1\r\nHost: a\r\n\r\n", 400},
+		{"version without minor", "GET / HTTP/1\r\nHost: a\r\n\r\n", 400},
+		{"HTTP/2", "GET / HTTP/2.0\r\nHost: a\r\n\r\n", 505},
+		{"header without colon", "GET / HTTP/1.1\r\nHost: a\r\nBroken\r\n\r\n", 400},
+		{"space before colon", "GET / HTTP/1.1\r\nHost : a\r\n\r\n", 400},
+		{"empty header name", "GET / HTTP/1.1\r\nHost: a\r\n: value\r\n\r\n", 400},
+		{"obs-fold", "GET / HTTP/1.1\r\nHost: a\r\nX-Long: 1\r\n 2\r\n\r\n", 400},
+		{"missing Host", "GET / HTTP/1.1\r\n\r\n", 400},
+		{"two Hosts", "GET / HTTP/1.1\r\nHost: a\r\nHost: b\r\n\r\n", 400},
+		{"too many headers", "GET / HTTP/1.1\r\nHost: a\r\n" + strings.Repeat("X-A: 1\r\n", maxHeaderCount) + "\r\n", 431},
+		{"line too long", "GET /" + strings.Repeat("a", maxLineLength) + " HTTP/1.1\r\nHost: a\r\n\r\n", 400},
+		{"invalid Content-Length", "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 1x\r\n\r\n", 400},
+		{"negative Content-Length", "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: -1\r\n\r\n", 400},
+		{"conflicting Content-Length", "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 1\r\nContent-Length: 2\r\n\r\nab", 400},
+		{"Transfer-Encoding and Content-Length", "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\nContent-Length: 1\r\n\r\n", 400},
+		{"Transfer-Encoding", "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n", 501},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readRequest(bufio.NewReader(strings.NewReader(tt.msg)))
+			var re *requestError
+			if !errors.As(err, &re) {
+				t.Fatalf("err = %v, want a requestError", err)
+			}
+			if re.statusCode != tt.statusCode {
+				t.Errorf("status code = %d (%v), want %d", re.statusCode, err, tt.statusCode)
+			}
+		})
+	}
+}
+
+func TestReadRequestEOF(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+		err  error
+	}{
+		{"closed before a request", "", io.EOF},
+		{"closed in the request line", "GET / HT", io.ErrUnexpectedEOF},
+		{"closed in the header", "GET / HTTP/1.1\r\nHost: a\r\n", io.ErrUnexpectedEOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readRequest(bufio.NewReader(strings.NewReader(tt.msg)))
+			if err != tt.err {
+				t.Errorf("err = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+)
+
+var statusTexts = map[int]string{
+	200: "OK",
+	201: "Created",
+	204: "No Content",
+	400: "Bad Request",
+	404: "Not Found",
+	405: "Method Not Allowed",
+	408: "Request Timeout",
+	413: "Content Too Large",
+	431: "Request Header Fields Too Large",
+	500: "Internal Server Error",
+	501: "Not Implemented",
+	505: "HTTP Version Not Supported",
+}
+
+func statusText(code int) string {
+	return statusTexts[code]
+}
+
+// status-line, header, bodyを組み立ててwに書き込む。
+func writeResponse(w io.Writer, statusCode int, header Header, body string) error {
+	if header == nil {
+		header = Header{}
+	}
+	if header.Get("Content-Length") == "" {
+		header.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+
+	msg := fmt.Sprintf("HTTP/1.1 %d %s\r\n", statusCode, statusText(statusCode))
+	for _, k := range slices.Sorted(maps.Keys(header)) {
+		for _, v := range header[k] {
+			msg += fmt.Sprintf("%s: %s\r\n", k, v)
+		}
+	}
+	msg += "\r\n" + body
+
+	_, err := w.Write([]byte(msg))
+	return err
+}
+
+// ハンドラーがレスポンスを組み立てるためのバッファ。
+// bodyを全て溜めてから送るので、Content-Lengthは自動で付く。
+type ResponseWriter struct {
+	header     Header
+	statusCode int
+	body       bytes.Buffer
+}
+
+func NewResponseWriter() *ResponseWriter {
+	return &ResponseWriter{header: Header{}, statusCode: 200}
+}
+
+func (w *ResponseWriter) Header() Header {
+	return w.header
+}
+
+func (w *ResponseWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+}
+
+func (w *ResponseWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+// 溜めたレスポンスをconnに書き込む。HEADリクエストにはbodyを送らない。
+func (w *ResponseWriter) flush(conn io.Writer, req *Request) error {
+	w.header.Set("Content-Length", strconv.Itoa(w.body.Len()))
+
+	body := w.body.String()
+	if req.Method == "HEAD" {
+		body = ""
+	}
+
+	return writeResponse(conn, w.statusCode, w.header, body)
+}
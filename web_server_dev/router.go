@@ -0,0 +1,202 @@
+package main
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+)
+
+type HandlerFunc func(w *ResponseWriter, req *Request)
+
+// methodとpathのpatternごとにハンドラーを振り分ける。
+//
+// patternは次の3種類。
+//   - "/users"        : 完全一致
+//   - "/static/"      : 末尾が'/'なら前方一致
+//   - "/users/{id}"   : {name}のセグメントは任意の1セグメントに一致し、req.PathValue("id")で取り出せる
+type Router struct {
+	routes []*route
+}
+
+type route struct {
+	pattern  string
+	segments []string
+	prefix   bool
+	handlers map[string]HandlerFunc
+}
+
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// methodとpatternにハンドラーを登録する。
+func (rt *Router) Handle(method, pattern string, h HandlerFunc) {
+	if !strings.HasPrefix(pattern, "/") {
+		panic("router: pattern must begin with '/': " + pattern)
+	}
+
+	r := rt.lookupPattern(pattern)
+	if r == nil {
+		r = &route{
+			pattern:  pattern,
+			segments: splitPath(pattern),
+			prefix:   strings.HasSuffix(pattern, "/") && pattern != "/",
+			handlers: map[string]HandlerFunc{},
+		}
+		rt.routes = append(rt.routes, r)
+	}
+
+	if _, ok := r.handlers[method]; ok {
+		panic("router: multiple registrations for " + method + " " + pattern)
+	}
+	r.handlers[method] = h
+}
+
+func (rt *Router) lookupPattern(pattern string) *route {
+	for _, r := range rt.routes {
+		if r.pattern == pattern {
+			return r
+		}
+	}
+	return nil
+}
+
+// リクエストに合うハンドラーを呼ぶ。
+// pathに合うpatternがなければ404、あってもmethodが違えば405とAllowヘッダーを返す。
+func (rt *Router) ServeHTTP(w *ResponseWriter, req *Request) {
+	type candidate struct {
+		r      *route
+		params map[string]string
+	}
+
+	var matches []candidate
+	for _, r := range rt.routes {
+		if params, ok := r.match(req.Path); ok {
+			matches = append(matches, candidate{r, params})
+		}
+	}
+
+	if len(matches) == 0 {
+		writeError(w, 404)
+		return
+	}
+
+	// より具体的なpatternを優先する。
+	slices.SortStableFunc(matches, func(a, b candidate) int {
+		return b.r.specificity() - a.r.specificity()
+	})
+
+	for _, m := range matches {
+		h, ok := m.r.handler(req.Method)
+		if ok {
+			req.params = m.params
+			h(w, req)
+			return
+		}
+	}
+
+	var allow []string
+	for _, m := range matches {
+		for _, method := range m.r.methods() {
+			if !slices.Contains(allow, method) {
+				allow = append(allow, method)
+			}
+		}
+	}
+	slices.Sort(allow)
+
+	w.Header().Set("Allow", strings.Join(allow, ", "))
+	writeError(w, 405)
+}
+
+// HEADはGETのハンドラーで代用する。
+func (r *route) handler(method string) (HandlerFunc, bool) {
+	h, ok := r.handlers[method]
+	if !ok && method == "HEAD" {
+		h, ok = r.handlers["GET"]
+	}
+	return h, ok
+}
+
+func (r *route) methods() []string {
+	var methods []string
+	for m := range r.handlers {
+		methods = append(methods, m)
+	}
+	if _, ok := r.handlers["GET"]; ok {
+		if _, ok := r.handlers["HEAD"]; !ok {
+			methods = append(methods, "HEAD")
+		}
+	}
+	return methods
+}
+
+// 前方一致より完全一致、{param}より固定のセグメントを優先するための値。
+func (r *route) specificity() int {
+	n := 0
+	for _, s := range r.segments {
+		n += 2
+		if !isParamSegment(s) {
+			n++
+		}
+	}
+	if !r.prefix {
+		n += 1000
+	}
+	return n
+}
+
+func (r *route) match(path string) (map[string]string, bool) {
+	if r.prefix {
+		return nil, strings.HasPrefix(path, r.pattern)
+	}
+
+	segments := splitPath(path)
+	if len(segments) != len(r.segments) {
+		return nil, false
+	}
+
+	var params map[string]string
+	for i, s := range r.segments {
+		if isParamSegment(s) {
+			if segments[i] == "" {
+				return nil, false
+			}
+			if params == nil {
+				params = map[string]string{}
+			}
+			v, err := url.PathUnescape(segments[i])
+			if err != nil {
+				v = segments[i]
+			}
+			params[s[1:len(s)-1]] = v
+			continue
+		}
+
+		if s != segments[i] {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+func isParamSegment(s string) bool {
+	return len(s) > 2 && strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}")
+}
+
+// "/a/b"を["a", "b"]にする。"/"は空のsliceになる。
+func splitPath(path string) []string {
+	path = strings.TrimPrefix(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// ステータスコードとその説明文だけのレスポンスを作る。
+func writeError(w *ResponseWriter, statusCode int) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(statusCode)
+	w.Write([]byte(statusText(statusCode)))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRouter(t *testing.T) {
+	rt := NewRouter()
+	handle := func(method, pattern string) {
+		rt.Handle(method, pattern, func(w *ResponseWriter, req *Request) {
+			w.Write([]byte(pattern + " " + req.PathValue("id")))
+		})
+	}
+	handle("GET", "/")
+	handle("GET", "/users")
+	handle("POST", "/users")
+	handle("GET", "/users/{id}")
+	handle("DELETE", "/users/{id}")
+	handle("GET", "/users/me")
+	handle("GET", "/static/")
+	handle("PUT", "/static/upload")
+
+	tests := []struct {
+		method     string
+		path       string
+		statusCode int
+		body       string
+		allow      string
+	}{
+		{"GET", "/", 200, "/ ", ""},
+		{"GET", "/users", 200, "/users ", ""},
+		{"POST", "/users", 200, "/users ", ""},
+		{"HEAD", "/users", 200, "/users ", ""},
+		{"GET", "/users/42", 200, "/users/{id} 42", ""},
+		{"GET", "/users/a%20b", 200, "/users/{id} a b", ""},
+		{"DELETE", "/users/42", 200, "/users/{id} 42", ""},
+		{"GET", "/users/me", 200, "/users/me ", ""},
+		{"DELETE", "/users/me", 200, "/users/{id} me", ""},
+		{"GET", "/static/css/a.css", 200, "/static/ ", ""},
+		{"GET", "/static/upload", 200, "/static/ ", ""},
+		{"PUT", "/static/upload", 200, "/static/upload ", ""},
+		{"GET", "/users/", 404, "Not Found", ""},
+		{"GET", "/users/42/posts", 404, "Not Found", ""},
+		{"GET", "/static", 404, "Not Found", ""},
+		{"GET", "/nothing", 404, "Not Found", ""},
+		{"PUT", "/users", 405, "Method Not Allowed", "GET, HEAD, POST"},
+		{"POST", "/users/42", 405, "Method Not Allowed", "DELETE, GET, HEAD"},
+		{"POST", "/static/upload", 405, "Method Not Allowed", "GET, HEAD, PUT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			w := NewResponseWriter()
+			rt.ServeHTTP(w, &Request{Method: tt.method, Path: tt.path, Header: Header{}})
+			if w.statusCode != tt.statusCode || w.body.String() != tt.body {
+				t.Errorf("got %d %q, want %d %q", w.statusCode, w.body.String(), tt.statusCode, tt.body)
+			}
+			if got := w.Header().Get("Allow"); got != tt.allow {
+				t.Errorf("Allow = %q, want %q", got, tt.allow)
+			}
+		})
+	}
+}
+
+func TestRouterHandlePanics(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+	}{
+		{"relative pattern", []string{"users"}},
+		{"duplicate registration", []string{"/users", "/users"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Handle did not panic")
+				}
+			}()
+			rt := NewRouter()
+			for _, p := range tt.patterns {
+				rt.Handle("GET", p, func(w *ResponseWriter, req *Request) {})
+			}
+		})
+	}
+}